@@ -0,0 +1,488 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	airtable "github.com/fabioberger/airtable-go"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// airtableRequestsPerSecond is the rate limit airtable enforces for each base.
+	airtableRequestsPerSecond = 5
+	// airtableRetryDelay is how long we wait when airtable rate limits us
+	// without a Retry-After header, it blocks the base for 30 seconds.
+	airtableRetryDelay = 30 * time.Second
+	// airtableBatchSize is the maximum number of records airtable accepts in
+	// a single create, update or delete request.
+	airtableBatchSize = 10
+	// airtableDateFormat is the format of the values of date columns that do
+	// not include the time.
+	airtableDateFormat = "2006-01-02"
+)
+
+// airtableSink is a Sink that stores records in an airtable table.
+//
+// Records are listed with the airtable client, but written with our own
+// batched requests since the client only supports one record at a time.
+type airtableSink struct {
+	client  *airtable.Client
+	api     *apiClient
+	table   string
+	limiter *rateLimiter
+
+	// columns maps the fields to the columns in the table, fields that are
+	// not in it are not synced.
+	columns map[string]string
+	// computed are the computed columns in the table.
+	computed []string
+	// other are columns we do not sync, but read to copy them to the archive
+	// table.
+	other []string
+	// projects looks up the records the Project column links to, if the
+	// job links records to projects.
+	projects *airtableProjects
+	// collaborators maps the logins of the assignees to the emails of
+	// airtable collaborators, if the Assignees column is a collaborator
+	// column.
+	collaborators map[string]string
+}
+
+// airtableProjects holds the records of the projects table by name, so the
+// Project column can link to them. It is shared by the sinks of a job.
+type airtableProjects struct {
+	table  string
+	column string
+	create bool
+
+	mu sync.Mutex
+	// ids maps the names of the projects to their record IDs, and names
+	// the other way around.
+	ids   map[string]string
+	names map[string]string
+	// warned holds the missing projects we already warned about.
+	warned map[string]bool
+}
+
+// newAirtableProjects creates the lookup for the projects in the table, by
+// their name in the column. Missing projects are created if create is set.
+func newAirtableProjects(table, column string, create bool) *airtableProjects {
+	return &airtableProjects{
+		table:  table,
+		column: column,
+		create: create,
+		ids:    map[string]string{},
+		names:  map[string]string{},
+		warned: map[string]bool{},
+	}
+}
+
+// known returns the projects that are in the projects table, or all of them
+// if missing projects are created. We warn about a missing project once.
+func (p *airtableProjects) known(names []string) []string {
+	if p.create {
+		return names
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	known := []string{}
+	for _, name := range names {
+		if _, ok := p.ids[name]; ok {
+			known = append(known, name)
+			continue
+		}
+		if !p.warned[name] {
+			logrus.Warnf("project %s is not in the projects table %s, leaving it out", name, p.table)
+			p.warned[name] = true
+		}
+	}
+	return known
+}
+
+// airtableRecord defines a record for the airtable batch API.
+type airtableRecord struct {
+	ID     string                 `json:"id,omitempty"`
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// airtableBatch defines the body for the airtable batch API.
+type airtableBatch struct {
+	Records []airtableRecord `json:"records"`
+	// Typecast has airtable create any select options that do not exist yet,
+	// like new labels.
+	Typecast bool `json:"typecast,omitempty"`
+}
+
+// newAirtableSink creates a new sink for the table in the airtable base, that
+// stores the fields in the columns along with the computed columns. The
+// limiter must be shared by every sink on the base, since airtable enforces
+// its rate limit for the whole base.
+func newAirtableSink(apiKey, baseID, table string, columns map[string]string, computed []string, limiter *rateLimiter, client *http.Client) (*airtableSink, error) {
+	c, err := airtable.New(apiKey, baseID)
+	if err != nil {
+		return nil, err
+	}
+
+	api, err := newAPIClient("https://api.airtable.com/v0/"+url.PathEscape(baseID), http.Header{"Authorization": []string{"Bearer " + apiKey}}, client)
+	if err != nil {
+		return nil, err
+	}
+	api.retryDelay = airtableRetryDelay
+
+	return &airtableSink{
+		client:   c,
+		api:      api,
+		table:    table,
+		limiter:  limiter,
+		columns:  columns,
+		computed: computed,
+	}, nil
+}
+
+// ListRecords returns all the records in the airtable table.
+func (s *airtableSink) ListRecords(ctx context.Context) ([]githubRecord, error) {
+	if err := s.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	rows := []airtableRecord{}
+	if err := s.client.ListRecords(s.table, &rows); err != nil {
+		return nil, fmt.Errorf("listing records for table %s failed: %v", s.table, err)
+	}
+
+	if s.projects != nil {
+		if err := s.listProjects(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	records := []githubRecord{}
+	for _, row := range rows {
+		// Map the columns back onto the fields, and let the JSON decoder
+		// convert the values.
+		values := map[string]interface{}{}
+		for field, column := range s.columns {
+			if v, ok := row.Fields[column]; ok {
+				values[field] = s.decode(field, v)
+			}
+		}
+		b, err := json.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+
+		record := githubRecord{ID: row.ID}
+		if err := json.Unmarshal(b, &record.Fields); err != nil {
+			return nil, fmt.Errorf("decoding record %s in table %s failed: %v", row.ID, s.table, err)
+		}
+
+		// The Project column holds the IDs of the linked records.
+		if s.projects != nil {
+			record.Fields.Project = s.projects.projectNames(record.Fields.Project)
+		}
+
+		if len(s.computed) > 0 {
+			record.Fields.Computed = map[string]string{}
+			for _, column := range s.computed {
+				if v, ok := row.Fields[column]; ok {
+					record.Fields.Computed[column] = fmt.Sprint(v)
+				}
+			}
+		}
+
+		if len(s.other) > 0 {
+			record.Fields.Other = map[string]interface{}{}
+			for _, column := range s.other {
+				if v, ok := row.Fields[column]; ok {
+					record.Fields.Other[column] = v
+				}
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// CreateRecords creates new rows in the airtable table.
+func (s *airtableSink) CreateRecords(ctx context.Context, records []githubRecord) error {
+	if err := s.createProjects(ctx, records); err != nil {
+		return err
+	}
+
+	return s.batch(ctx, records, func(chunk []githubRecord) error {
+		body := airtableBatch{Typecast: true}
+		for _, record := range chunk {
+			body.Records = append(body.Records, airtableRecord{Fields: s.fields(record.Fields)})
+		}
+
+		var created airtableBatch
+		if err := s.request(ctx, http.MethodPost, nil, body, &created); err != nil {
+			return err
+		}
+
+		// Airtable returns the records in the order they were sent.
+		for i := range chunk {
+			if i < len(created.Records) {
+				chunk[i].ID = created.Records[i].ID
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateRecords updates existing rows in the airtable table.
+func (s *airtableSink) UpdateRecords(ctx context.Context, records []githubRecord) error {
+	if err := s.createProjects(ctx, records); err != nil {
+		return err
+	}
+
+	return s.batch(ctx, records, func(chunk []githubRecord) error {
+		body := airtableBatch{Typecast: true}
+		for _, record := range chunk {
+			body.Records = append(body.Records, airtableRecord{
+				ID:     record.ID,
+				Fields: s.fields(record.Fields),
+			})
+		}
+
+		return s.request(ctx, http.MethodPatch, nil, body, nil)
+	})
+}
+
+// DestroyRecords deletes rows from the airtable table.
+func (s *airtableSink) DestroyRecords(ctx context.Context, records []githubRecord) error {
+	return s.batch(ctx, records, func(chunk []githubRecord) error {
+		query := url.Values{}
+		for _, record := range chunk {
+			query.Add("records[]", record.ID)
+		}
+
+		return s.request(ctx, http.MethodDelete, query, nil, nil)
+	})
+}
+
+// batch calls fn for the records in chunks of the airtable batch size. The
+// returned error holds the references of every record in a failed chunk.
+func (s *airtableSink) batch(ctx context.Context, records []githubRecord, fn func(chunk []githubRecord) error) error {
+	var failed syncErrors
+	for start := 0; start < len(records); start += airtableBatchSize {
+		end := start + airtableBatchSize
+		if end > len(records) {
+			end = len(records)
+		}
+		chunk := records[start:end]
+
+		if err := fn(chunk); err != nil {
+			for _, record := range chunk {
+				failed.add(record.Fields.Reference, err)
+			}
+		}
+	}
+	return failed.errorOrNil()
+}
+
+// listProjects reads the records in the projects table.
+func (s *airtableSink) listProjects(ctx context.Context) error {
+	if err := s.limiter.wait(ctx); err != nil {
+		return err
+	}
+
+	rows := []airtableRecord{}
+	if err := s.client.ListRecords(s.projects.table, &rows); err != nil {
+		return fmt.Errorf("listing records for projects table %s failed: %v", s.projects.table, err)
+	}
+
+	s.projects.mu.Lock()
+	defer s.projects.mu.Unlock()
+	s.projects.ids = map[string]string{}
+	s.projects.names = map[string]string{}
+	for _, row := range rows {
+		name, ok := row.Fields[s.projects.column].(string)
+		if !ok || len(name) < 1 {
+			continue
+		}
+		s.projects.ids[name] = row.ID
+		s.projects.names[row.ID] = name
+	}
+	return nil
+}
+
+// createProjects creates the projects of the records missing from the
+// projects table, if we are allowed to.
+func (s *airtableSink) createProjects(ctx context.Context, records []githubRecord) error {
+	if s.projects == nil {
+		return nil
+	}
+
+	s.projects.mu.Lock()
+	missing := []string{}
+	for _, record := range records {
+		for _, name := range record.Fields.Project {
+			if _, ok := s.projects.ids[name]; !ok && !in(missing, name) {
+				missing = append(missing, name)
+			}
+		}
+	}
+	s.projects.mu.Unlock()
+
+	// Without create, the bot already left out the missing projects.
+	if len(missing) == 0 || !s.projects.create {
+		return nil
+	}
+
+	for start := 0; start < len(missing); start += airtableBatchSize {
+		end := start + airtableBatchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+
+		body := airtableBatch{}
+		for _, name := range missing[start:end] {
+			body.Records = append(body.Records, airtableRecord{Fields: map[string]interface{}{s.projects.column: name}})
+		}
+		var created airtableBatch
+		if err := s.requestTable(ctx, s.projects.table, http.MethodPost, nil, body, &created); err != nil {
+			return fmt.Errorf("creating projects in table %s failed: %v", s.projects.table, err)
+		}
+
+		s.projects.mu.Lock()
+		for n, name := range missing[start:end] {
+			if n < len(created.Records) {
+				s.projects.ids[name] = created.Records[n].ID
+				s.projects.names[created.Records[n].ID] = name
+			}
+		}
+		s.projects.mu.Unlock()
+	}
+	return nil
+}
+
+// projectNames returns the names of the linked project records, keeping the
+// IDs of the ones we do not know.
+func (p *airtableProjects) projectNames(ids []string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	names := []string{}
+	for _, id := range ids {
+		if name, ok := p.names[id]; ok {
+			id = name
+		}
+		names = append(names, id)
+	}
+	return names
+}
+
+// projectIDs returns the IDs of the project records to link to, leaving out
+// the projects that are not in the projects table.
+func (p *airtableProjects) projectIDs(names []string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ids := []string{}
+	for _, name := range names {
+		if id, ok := p.ids[name]; ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// request sends a rate limited request to the airtable table.
+func (s *airtableSink) request(ctx context.Context, method string, query url.Values, body, v interface{}) error {
+	return s.requestTable(ctx, s.table, method, query, body, v)
+}
+
+// requestTable sends a rate limited request to a table in the base.
+func (s *airtableSink) requestTable(ctx context.Context, table, method string, query url.Values, body, v interface{}) error {
+	if err := s.limiter.wait(ctx); err != nil {
+		return err
+	}
+
+	_, err := s.api.do(ctx, method, url.PathEscape(table), query, body, v)
+	return err
+}
+
+// fields returns the airtable column values for the fields.
+func (s *airtableSink) fields(f Fields) map[string]interface{} {
+	values := reflect.ValueOf(f)
+
+	fields := map[string]interface{}{}
+	for field, column := range s.columns {
+		v := values.FieldByName(field).Interface()
+		// Clear the dates the issue does not have.
+		if t, ok := v.(time.Time); ok && t.IsZero() {
+			v = nil
+		}
+		fields[column] = v
+	}
+	if column, ok := s.columns["MilestoneDueDate"]; ok && !f.MilestoneDueDate.IsZero() {
+		fields[column] = f.MilestoneDueDate.UTC().Format(airtableDateFormat)
+	}
+	if column, ok := s.columns["Assignees"]; ok && len(s.collaborators) > 0 {
+		collaborators := []map[string]string{}
+		for _, assignee := range f.Assignees {
+			if email, ok := s.collaborators[assignee]; ok {
+				collaborators = append(collaborators, map[string]string{"email": email})
+			}
+		}
+		fields[column] = collaborators
+	}
+	if column, ok := s.columns["Project"]; ok && s.projects != nil {
+		fields[column] = s.projects.projectIDs(f.Project)
+	}
+	for column, v := range f.Computed {
+		fields[column] = v
+	}
+	for column, v := range f.Other {
+		fields[column] = v
+	}
+	return fields
+}
+
+// decode converts the value of the column for a field to what the field
+// decodes from: dates without a time to timestamps, and collaborators to
+// the logins they are for.
+func (s *airtableSink) decode(field string, v interface{}) interface{} {
+	switch field {
+	case "MilestoneDueDate":
+		if d, ok := v.(string); ok {
+			if t, err := time.Parse(airtableDateFormat, d); err == nil {
+				return t
+			}
+		}
+	case "Assignees":
+		collaborators, ok := v.([]interface{})
+		if !ok || len(s.collaborators) == 0 {
+			return v
+		}
+		logins := []string{}
+		for _, c := range collaborators {
+			collaborator, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			email, _ := collaborator["email"].(string)
+			login := email
+			for l, e := range s.collaborators {
+				if strings.EqualFold(e, email) {
+					login = l
+					break
+				}
+			}
+			logins = append(logins, login)
+		}
+		return logins
+	}
+	return v
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// retryDelayIfRateLimited is how long we wait before retrying a request that
+// hit the rate limit, when the server does not tell us.
+const retryDelayIfRateLimited = 5 * time.Second
+
+// apiClient is a minimal JSON client for the REST APIs of forges we do not
+// have a client library for, and for the requests our client libraries do not
+// cover, like airtable batch writes and the GitHub GraphQL API.
+type apiClient struct {
+	baseURL *url.URL
+	header  http.Header
+	client  *http.Client
+	// retryDelay is how long we wait before retrying a request that hit the
+	// rate limit, when the server does not tell us.
+	retryDelay time.Duration
+	// log is where we log the requests that hit the rate limit.
+	log *logrus.Entry
+}
+
+// newAPIClient creates a new client for the API at the base URL, every request
+// is sent with the header.
+func newAPIClient(baseURL string, header http.Header, client *http.Client) (*apiClient, error) {
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &apiClient{
+		baseURL:    u,
+		header:     header,
+		client:     client,
+		retryDelay: retryDelayIfRateLimited,
+		log:        logrus.NewEntry(logrus.StandardLogger()),
+	}, nil
+}
+
+// get sends a GET request for the path, relative to the base URL, and decodes
+// the JSON response into v. Path segments must already be escaped.
+func (c *apiClient) get(ctx context.Context, path string, query url.Values, v interface{}) (*http.Response, error) {
+	return c.do(ctx, http.MethodGet, path, query, nil, v)
+}
+
+// do sends a request for the path, relative to the base URL, with the body
+// encoded as JSON and decodes the JSON response into v. Path segments must
+// already be escaped.
+// Requests that hit the rate limit are retried after the time the server asks
+// us to wait.
+func (c *apiClient) do(ctx context.Context, method, path string, query url.Values, body, v interface{}) (*http.Response, error) {
+	u, err := c.baseURL.Parse(strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = query.Encode()
+
+	var b []byte
+	if body != nil {
+		b, err = json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		req, err := http.NewRequest(method, u.String(), bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Accept", "application/json")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		for k, vals := range c.header {
+			for _, val := range vals {
+				req.Header.Add(k, val)
+			}
+		}
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			resp.Body.Close()
+			wait := c.retryDelay
+			if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				wait = time.Duration(secs) * time.Second
+			}
+			c.log.Warnf("hit the rate limit for %s, waiting %s before retrying", c.baseURL.Host, wait)
+			if err := sleep(ctx, wait); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		return resp, c.decode(resp, method, u, v)
+	}
+}
+
+// decode checks the status of the response and decodes the JSON body into v.
+func (c *apiClient) decode(resp *http.Response, method string, u *url.URL, v interface{}) error {
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// Include the start of the body, APIs usually explain what went wrong.
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s failed: %s %s", method, u.String(), resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return fmt.Errorf("decoding response from %s failed: %v", u.String(), err)
+		}
+	}
+
+	return nil
+}
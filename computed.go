@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// computedFuncs are the functions computed columns can use, on top of the
+// text/template builtins.
+var computedFuncs = template.FuncMap{
+	// days returns the number of whole days since t.
+	"days": func(t time.Time) int {
+		if t.IsZero() {
+			return 0
+		}
+		return int(time.Since(t).Hours() / 24)
+	},
+	// has reports whether the list holds s, like a label.
+	"has": func(list []string, s string) bool {
+		return in(list, s)
+	},
+	// prefixed returns the first value in the list that starts with prefix,
+	// without the prefix, like "P1" for the labels [bug priority/P1].
+	"prefixed": func(list []string, prefix string) string {
+		for _, s := range list {
+			if strings.HasPrefix(s, prefix) {
+				return strings.TrimPrefix(s, prefix)
+			}
+		}
+		return ""
+	},
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"now":   time.Now,
+}
+
+// computedData is what the templates for computed columns are executed with.
+// The fields are embedded so templates can use {{.Title}}, and Issue is the
+// issue or pull request as the source returned it, like the *github.Issue for
+// GitHub.
+type computedData struct {
+	Fields
+	Issue interface{}
+}
+
+// computedColumn is a column whose value is computed from the issue with a
+// template.
+type computedColumn struct {
+	column   string
+	template *template.Template
+}
+
+// parseComputed parses the templates for the computed columns, sorted by
+// column.
+func parseComputed(computed map[string]string) ([]computedColumn, error) {
+	columns := []computedColumn{}
+	for column, text := range computed {
+		t, err := template.New(column).Funcs(computedFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("parsing template for computed column %s failed: %v", column, err)
+		}
+		columns = append(columns, computedColumn{column: column, template: t})
+	}
+
+	sort.Slice(columns, func(i, j int) bool {
+		return columns[i].column < columns[j].column
+	})
+	return columns, nil
+}
+
+// computedColumns returns the names of the computed columns.
+func computedColumns(computed []computedColumn) []string {
+	columns := []string{}
+	for _, c := range computed {
+		columns = append(columns, c.column)
+	}
+	return columns
+}
+
+// compute returns the value of the column for the issue.
+func (c computedColumn) compute(i *item) (string, error) {
+	var b bytes.Buffer
+	if err := c.template.Execute(&b, computedData{Fields: i.fields, Issue: i.raw}); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// config is the configuration file, it describes the jobs to run.
+type config struct {
+	Jobs []jobConfig `yaml:"jobs"`
+}
+
+// jobConfig describes a job, which syncs one table. Without a configuration
+// file there is a single job, described by the flags.
+type jobConfig struct {
+	// Name identifies the job in the logs.
+	Name string `yaml:"name"`
+	// Interval is how often the job runs, it defaults to --interval.
+	Interval time.Duration `yaml:"interval"`
+
+	Airtable struct {
+		BaseID string `yaml:"base_id"`
+		Table  string `yaml:"table"`
+	} `yaml:"airtable"`
+
+	// Autofill fills the table with the issues of the repositories for the
+	// orgs and groups.
+	Autofill bool     `yaml:"autofill"`
+	Orgs     []string `yaml:"orgs"`
+	// OrgRepoType is the type of the repositories to autofill for the
+	// GitHub orgs, it defaults to --org-repo-type.
+	OrgRepoType  string   `yaml:"org_repo_type"`
+	GitLabGroups []string `yaml:"gitlab_groups"`
+	GiteaOrgs    []string `yaml:"gitea_orgs"`
+	// Teams are GitHub teams whose repositories are autofilled too, in the
+	// format {org}/{team-slug}. TeamMembersOnly limits the autofilled
+	// issues to the ones authored by or assigned to team members.
+	Teams           []string `yaml:"teams"`
+	TeamMembersOnly bool     `yaml:"team_members_only"`
+	// Watched fills the table with the issues of the watched repositories.
+	Watched bool `yaml:"watched"`
+	// Starred fills the table with the issues of the repositories starred
+	// by StarredUser, or by the token's user if it is empty.
+	Starred     bool   `yaml:"starred"`
+	StarredUser string `yaml:"starred_user"`
+	// MyWork fills the table with the open issues and pull requests the
+	// token's user is involved in, across all repositories.
+	MyWork bool `yaml:"my_work"`
+	// Repos fills the table with the issues of the repositories, in the
+	// format [{host}:]{owner}/{repo}.
+	Repos []string `yaml:"repos"`
+	// Search fills the table with the issues and pull requests matching the
+	// GitHub search query.
+	Search string `yaml:"search"`
+
+	// Fields maps the fields to the columns of the table, for tables that
+	// use other names. A field mapped to "-" is not synced. The optional
+	// fields are only synced if they are mapped.
+	Fields map[string]string `yaml:"fields"`
+	// Computed maps columns to the templates their values are computed
+	// with.
+	Computed map[string]string `yaml:"computed"`
+	// Collaborators maps the logins of the assignees to the emails of
+	// airtable collaborators, for an Assignees column of collaborators
+	// instead of a multiple select. Other assignees are left out.
+	Collaborators map[string]string `yaml:"collaborators"`
+
+	// Filters are the rules issues have to match to be added to the table.
+	Filters filterConfig `yaml:"filters"`
+	// Projects are the rules linking the records to their projects.
+	Projects projectsConfig `yaml:"projects"`
+	// Retention is what happens to the records for issues that are gone or
+	// closed for a while.
+	Retention retentionConfig `yaml:"retention"`
+}
+
+// orgRepoTypes are the types of repositories GitHub can list for an org,
+// internal is only on GitHub Enterprise.
+var orgRepoTypes = []string{"all", "public", "private", "forks", "sources", "member", "internal"}
+
+// loadJobs returns the jobs from the configuration file, or the job described
+// by the flags if there is no configuration file.
+func loadJobs(path string) ([]jobConfig, error) {
+	if path == "" {
+		job := jobConfig{
+			Name:            airtableTableName,
+			Interval:        interval,
+			Autofill:        autofill,
+			Orgs:            orgs,
+			OrgRepoType:     orgRepoType,
+			Teams:           teams,
+			TeamMembersOnly: teamMembers,
+			GitLabGroups:    gitlabGroups,
+			GiteaOrgs:       giteaOrgs,
+			Watched:         watched,
+			Starred:         starred,
+			StarredUser:     starredUser,
+			MyWork:          myWork,
+			Search:          search,
+		}
+		job.Airtable.BaseID = airtableBaseID
+		job.Airtable.Table = airtableTableName
+		// Sync the optional fields to their default columns.
+		for _, field := range fields {
+			if job.Fields == nil {
+				job.Fields = map[string]string{}
+			}
+			job.Fields[field] = field
+			if column, ok := fieldColumns[field]; ok {
+				job.Fields[field] = column
+			}
+		}
+		return []jobConfig{job}, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c config
+	if err := yaml.UnmarshalStrict(b, &c); err != nil {
+		return nil, fmt.Errorf("parsing config file %s failed: %v", path, err)
+	}
+
+	if len(c.Jobs) < 1 {
+		return nil, fmt.Errorf("config file %s has no jobs", path)
+	}
+
+	names := map[string]bool{}
+	for n, job := range c.Jobs {
+		if len(job.Name) < 1 {
+			return nil, fmt.Errorf("job %d in config file %s has no name", n+1, path)
+		}
+		if names[job.Name] {
+			return nil, fmt.Errorf("job name %s in config file %s is not unique", job.Name, path)
+		}
+		names[job.Name] = true
+
+		if err := job.validate(); err != nil {
+			return nil, fmt.Errorf("job %s in config file %s is invalid: %v", job.Name, path, err)
+		}
+		if job.Interval == 0 {
+			c.Jobs[n].Interval = interval
+		}
+		if len(job.OrgRepoType) < 1 {
+			c.Jobs[n].OrgRepoType = orgRepoType
+		}
+	}
+
+	return c.Jobs, nil
+}
+
+// validate checks the job has everything it needs.
+func (job jobConfig) validate() error {
+	if len(job.Airtable.BaseID) < 1 {
+		return errors.New("airtable Base ID cannot be empty")
+	}
+
+	if len(job.Airtable.Table) < 1 {
+		return errors.New("airtable Table cannot be empty")
+	}
+
+	if job.Interval < 0 {
+		return errors.New("interval cannot be negative")
+	}
+
+	if len(job.OrgRepoType) > 0 && !in(orgRepoTypes, job.OrgRepoType) {
+		return fmt.Errorf("unknown org_repo_type %s, expected one of %s", job.OrgRepoType, strings.Join(orgRepoTypes, ", "))
+	}
+
+	for _, team := range job.Teams {
+		if _, err := githubTeamPath(team); err != nil {
+			return err
+		}
+	}
+
+	for _, repo := range job.Repos {
+		if _, err := parseRepository(repo); err != nil {
+			return err
+		}
+	}
+
+	for field, column := range job.Fields {
+		if !in(fieldNames, field) {
+			return fmt.Errorf("unknown field %s, expected one of %s", field, strings.Join(fieldNames, ", "))
+		}
+		if len(column) < 1 {
+			return fmt.Errorf("column for field %s cannot be empty, use - to not sync it", field)
+		}
+		if field == "Reference" && column == "-" {
+			return errors.New("field Reference cannot be disabled, it identifies the records")
+		}
+	}
+
+	columns := map[string]string{}
+	mapping := job.columns()
+	for _, field := range fieldNames {
+		column, ok := mapping[field]
+		if !ok {
+			continue
+		}
+		if other, ok := columns[column]; ok {
+			return fmt.Errorf("fields %s and %s are both mapped to column %s", other, field, column)
+		}
+		columns[column] = field
+	}
+
+	for column := range job.Computed {
+		if field, ok := columns[column]; ok {
+			return fmt.Errorf("computed column %s is already the column for field %s", column, field)
+		}
+		if in(fieldNames, column) {
+			return fmt.Errorf("computed column %s cannot have the name of a field", column)
+		}
+	}
+	if _, err := parseComputed(job.Computed); err != nil {
+		return err
+	}
+
+	if _, ok := job.columns()["Assignees"]; len(job.Collaborators) > 0 && !ok {
+		return errors.New("collaborators need the Assignees field to be synced")
+	}
+	for login, email := range job.Collaborators {
+		if len(email) < 1 {
+			return fmt.Errorf("collaborator email for %s cannot be empty", login)
+		}
+	}
+
+	if err := job.Filters.validate(); err != nil {
+		return err
+	}
+
+	if err := job.Projects.validate(job); err != nil {
+		return err
+	}
+	if _, ok := job.columns()["Project"]; job.Projects.enabled() && !ok {
+		return errors.New("field Project cannot be disabled when there is a projects table")
+	}
+
+	if err := job.Retention.validate(job); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// columns returns the column for each of the fields the job syncs. Project is
+// only synced if the job links records to projects, and the optional fields
+// if the job maps them.
+func (job jobConfig) columns() map[string]string {
+	columns := map[string]string{}
+	for _, field := range fieldNames {
+		if field == "Project" && !job.Projects.enabled() {
+			continue
+		}
+		column, ok := job.Fields[field]
+		if !ok && in(optionalFields, field) {
+			continue
+		}
+		if !ok {
+			column = field
+		}
+		if column == "-" {
+			continue
+		}
+		columns[field] = column
+	}
+	return columns
+}
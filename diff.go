@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"time"
+)
+
+// changedFields returns the names of the fields that differ between the
+// existing record in the sink and the freshly built one.
+func changedFields(existing, fresh Fields) []string {
+	changed := []string{}
+	check := func(name string, equal bool) {
+		if !equal {
+			changed = append(changed, name)
+		}
+	}
+
+	check("Reference", existing.Reference == fresh.Reference)
+	check("Title", existing.Title == fresh.Title)
+	check("State", existing.State == fresh.State)
+	check("Author", existing.Author == fresh.Author)
+	check("Type", existing.Type == fresh.Type)
+	check("Labels", equalStrings(existing.Labels, fresh.Labels))
+	check("Assignees", equalStrings(existing.Assignees, fresh.Assignees))
+	check("Milestone", existing.Milestone == fresh.Milestone)
+	check("MilestoneDueDate", equalDate(existing.MilestoneDueDate, fresh.MilestoneDueDate))
+	check("Comments", existing.Comments == fresh.Comments)
+	check("URL", existing.URL == fresh.URL)
+	check("Updated", equalTime(existing.Updated, fresh.Updated))
+	check("Created", equalTime(existing.Created, fresh.Created))
+	check("Completed", equalTime(existing.Completed, fresh.Completed))
+	check("Project", equalStrings(existing.Project, fresh.Project))
+	check("Repository", existing.Repository == fresh.Repository)
+
+	// The computed columns are compared by their column name.
+	columns := []string{}
+	for column := range fresh.Computed {
+		columns = append(columns, column)
+	}
+	for column := range existing.Computed {
+		if _, ok := fresh.Computed[column]; !ok {
+			columns = append(columns, column)
+		}
+	}
+	sort.Strings(columns)
+	for _, column := range columns {
+		check(column, existing.Computed[column] == fresh.Computed[column])
+	}
+
+	return changed
+}
+
+// fieldValue returns the value of the field, or of the computed column, with
+// the name.
+func fieldValue(f Fields, name string) interface{} {
+	if v, ok := f.Computed[name]; ok {
+		return v
+	}
+	if v := reflect.ValueOf(f).FieldByName(name); v.IsValid() {
+		return v.Interface()
+	}
+	return nil
+}
+
+// equalStrings reports whether a and b hold the same strings, in any order.
+// A nil slice is equal to an empty one.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	x := append([]string{}, a...)
+	y := append([]string{}, b...)
+	sort.Strings(x)
+	sort.Strings(y)
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// equalDate reports whether a and b are on the same day in UTC, for the
+// fields the sink stores as a date.
+func equalDate(a, b time.Time) bool {
+	return a.UTC().Format(airtableDateFormat) == b.UTC().Format(airtableDateFormat)
+}
+
+// equalTime reports whether a and b are the same instant, to the second,
+// since sinks may not store the full precision of the source.
+func equalTime(a, b time.Time) bool {
+	return a.Truncate(time.Second).Equal(b.Truncate(time.Second))
+}
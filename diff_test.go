@@ -0,0 +1,102 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChangedFields(t *testing.T) {
+	now := time.Date(2020, time.March, 4, 10, 30, 0, 0, time.UTC)
+	existing := Fields{
+		Reference: "jessfraz/gitable#1",
+		Title:     "Fix the thing",
+		State:     "open",
+		Labels:    []string{"bug", "help wanted"},
+		Updated:   now,
+		Milestone: "v1.0",
+		// GitLab milestones are due at midnight.
+		MilestoneDueDate: time.Date(2020, time.April, 1, 0, 0, 0, 0, time.UTC),
+		Computed:         map[string]string{"Age": "3"},
+	}
+
+	testCases := []struct {
+		name   string
+		change func(f *Fields)
+		want   []string
+	}{
+		{
+			name:   "unchanged",
+			change: func(f *Fields) {},
+			want:   []string{},
+		},
+		{
+			name:   "title",
+			change: func(f *Fields) { f.Title = "Fix the other thing" },
+			want:   []string{"Title"},
+		},
+		{
+			name:   "labels in another order",
+			change: func(f *Fields) { f.Labels = []string{"help wanted", "bug"} },
+			want:   []string{},
+		},
+		{
+			name:   "label removed",
+			change: func(f *Fields) { f.Labels = []string{"bug"} },
+			want:   []string{"Labels"},
+		},
+		{
+			name:   "nil and empty assignees",
+			change: func(f *Fields) { f.Assignees = []string{} },
+			want:   []string{},
+		},
+		{
+			name:   "updated below a second",
+			change: func(f *Fields) { f.Updated = now.Add(500 * time.Millisecond) },
+			want:   []string{},
+		},
+		{
+			name:   "updated and state",
+			change: func(f *Fields) { f.Updated = now.Add(time.Hour); f.State = "closed" },
+			want:   []string{"State", "Updated"},
+		},
+		{
+			// GitHub milestones are due at a time of day.
+			name:   "milestone due date on the same day",
+			change: func(f *Fields) { f.MilestoneDueDate = time.Date(2020, time.April, 1, 7, 0, 0, 0, time.UTC) },
+			want:   []string{},
+		},
+		{
+			name:   "milestone cleared",
+			change: func(f *Fields) { f.Milestone, f.MilestoneDueDate = "", time.Time{} },
+			want:   []string{"Milestone", "MilestoneDueDate"},
+		},
+		{
+			name:   "computed column changed",
+			change: func(f *Fields) { f.Computed = map[string]string{"Age": "4"} },
+			want:   []string{"Age"},
+		},
+		{
+			name:   "computed column added and removed",
+			change: func(f *Fields) { f.Computed = map[string]string{"Summary": "gitable"} },
+			want:   []string{"Age", "Summary"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fresh := existing
+			fresh.Labels = append([]string{}, existing.Labels...)
+			fresh.Computed = map[string]string{}
+			for k, v := range existing.Computed {
+				fresh.Computed[k] = v
+			}
+			tc.change(&fresh)
+
+			got := changedFields(existing, fresh)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
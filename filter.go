@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// filterConfig defines the rules an issue has to match to be added to the
+// table. Empty rules match everything.
+type filterConfig struct {
+	// States are the states to match, like open, closed or merged.
+	States []string `yaml:"states"`
+	// Types are the types to match, like issue, pull request or merge
+	// request.
+	Types   []string   `yaml:"types"`
+	Labels  listFilter `yaml:"labels"`
+	Authors listFilter `yaml:"authors"`
+	// CreatedWithin only matches issues created within the duration.
+	CreatedWithin time.Duration `yaml:"created_within"`
+	// ClosedWithin only matches issues that are open, or were closed within
+	// the duration.
+	ClosedWithin time.Duration `yaml:"closed_within"`
+	// Draft only matches drafts if true, and everything but drafts if false.
+	Draft *bool `yaml:"draft"`
+
+	// Repositories are the rules the repositories autofill lists have to
+	// match for their issues to be added.
+	Repositories repoFilter `yaml:"repositories"`
+
+	// Prune deletes the records for issues that no longer match, instead
+	// of only not adding new ones.
+	Prune bool `yaml:"prune"`
+}
+
+// listFilter matches a list of values, like the labels of an issue.
+type listFilter struct {
+	// Include matches if any of the values are in it.
+	Include []string `yaml:"include"`
+	// Exclude matches if none of the values are in it.
+	Exclude []string `yaml:"exclude"`
+}
+
+// repoFilter defines the rules a repository has to match to be autofilled.
+// Empty rules match everything.
+type repoFilter struct {
+	// Include and Exclude are patterns for the {owner}/{repo} name of the
+	// repository, either globs like "genuinetools/*" or regular expressions
+	// between slashes like "/^genuinetools/.*-bot$/".
+	Include []string   `yaml:"include"`
+	Exclude []string   `yaml:"exclude"`
+	Topics  listFilter `yaml:"topics"`
+	// Visibility is the visibilities to match, like public, private or
+	// internal.
+	Visibility []string `yaml:"visibility"`
+	// Fork only matches forks if true, and everything but forks if false.
+	Fork *bool `yaml:"fork"`
+	// Archived only matches archived repositories if true, and everything
+	// but them if false.
+	Archived *bool `yaml:"archived"`
+}
+
+// validate checks the filter rules make sense.
+func (f filterConfig) validate() error {
+	if f.CreatedWithin < 0 {
+		return errors.New("created_within cannot be negative")
+	}
+	if f.ClosedWithin < 0 {
+		return errors.New("closed_within cannot be negative")
+	}
+	return f.Repositories.validate()
+}
+
+// validate checks the repository patterns parse.
+func (f repoFilter) validate() error {
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if _, err := matchPattern(pattern, ""); err != nil {
+			return fmt.Errorf("invalid repository pattern %s: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// match reports whether the issue matches the filter rules.
+func (f filterConfig) match(i *item) bool {
+	if len(f.States) > 0 && !in(f.States, i.fields.State) {
+		return false
+	}
+
+	if len(f.Types) > 0 && !in(f.Types, i.fields.Type) {
+		return false
+	}
+
+	if !f.Labels.match(i.fields.Labels) {
+		return false
+	}
+
+	if !f.Authors.match([]string{i.fields.Author}) {
+		return false
+	}
+
+	if f.CreatedWithin > 0 && time.Since(i.fields.Created) > f.CreatedWithin {
+		return false
+	}
+
+	if f.ClosedWithin > 0 && !i.fields.Completed.IsZero() && time.Since(i.fields.Completed) > f.ClosedWithin {
+		return false
+	}
+
+	if f.Draft != nil && *f.Draft != i.draft {
+		return false
+	}
+
+	return true
+}
+
+// match reports whether the values match the filter.
+func (f listFilter) match(values []string) bool {
+	for _, v := range values {
+		if in(f.Exclude, v) {
+			return false
+		}
+	}
+
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if in(f.Include, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether the repository matches the filter rules.
+func (f repoFilter) match(repo repository) bool {
+	name := repo.FullName()
+	for _, pattern := range f.Exclude {
+		if ok, _ := matchPattern(pattern, name); ok {
+			return false
+		}
+	}
+
+	if len(f.Include) > 0 {
+		included := false
+		for _, pattern := range f.Include {
+			if ok, _ := matchPattern(pattern, name); ok {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+
+	if !f.Topics.match(repo.Topics) {
+		return false
+	}
+
+	if len(f.Visibility) > 0 && !in(f.Visibility, repo.Visibility) {
+		return false
+	}
+
+	if f.Fork != nil && *f.Fork != repo.Fork {
+		return false
+	}
+
+	if f.Archived != nil && *f.Archived != repo.Archived {
+		return false
+	}
+
+	return true
+}
+
+// matchPattern reports whether the name matches the pattern, which is a
+// regular expression if it is between slashes and a glob otherwise.
+func matchPattern(pattern, name string) (bool, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		return regexp.MatchString(pattern[1:len(pattern)-1], name)
+	}
+	return path.Match(pattern, name)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// giteaPerPage is the maximum page size Gitea allows by default.
+const giteaPerPage = 50
+
+// giteaSource is a Source for Gitea and Forgejo instances.
+type giteaSource struct {
+	api  *apiClient
+	host string
+	orgs []string
+	// log is the logger of the job the source fetches for.
+	log *logrus.Entry
+}
+
+// giteaUser defines the user fields we use from the Gitea API.
+type giteaUser struct {
+	Login string `json:"login"`
+}
+
+// giteaRepository defines the repository fields we use from the Gitea API.
+type giteaRepository struct {
+	Name     string    `json:"name"`
+	Owner    giteaUser `json:"owner"`
+	Topics   []string  `json:"topics"`
+	Private  bool      `json:"private"`
+	Internal bool      `json:"internal"`
+	Fork     bool      `json:"fork"`
+	Archived bool      `json:"archived"`
+}
+
+// giteaIssue defines the fields we use from Gitea issues and pull requests.
+type giteaIssue struct {
+	Number    int         `json:"number"`
+	Title     string      `json:"title"`
+	State     string      `json:"state"`
+	User      giteaUser   `json:"user"`
+	Assignees []giteaUser `json:"assignees"`
+	Milestone *struct {
+		Title string     `json:"title"`
+		DueOn *time.Time `json:"due_on"`
+	} `json:"milestone"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Comments    int        `json:"comments"`
+	HTMLURL     string     `json:"html_url"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ClosedAt    *time.Time `json:"closed_at"`
+	PullRequest *struct {
+		Merged   bool       `json:"merged"`
+		MergedAt *time.Time `json:"merged_at"`
+		Draft    bool       `json:"draft"`
+	} `json:"pull_request"`
+}
+
+// newGiteaSource creates a new source for the Gitea instance at baseURL that
+// autofills the repositories in the orgs, or the repositories of the user if
+// no orgs are given.
+func newGiteaSource(baseURL, token string, orgs []string, client *http.Client, log *logrus.Entry) (*giteaSource, error) {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	if !strings.HasSuffix(baseURL, "/api/v1") {
+		baseURL += "/api/v1"
+	}
+
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "token "+token)
+	}
+
+	api, err := newAPIClient(baseURL, header, client)
+	if err != nil {
+		return nil, err
+	}
+	api.log = log
+
+	return &giteaSource{
+		api:  api,
+		host: api.baseURL.Host,
+		orgs: orgs,
+		log:  log,
+	}, nil
+}
+
+// Host returns the host of the Gitea instance.
+func (s *giteaSource) Host() string {
+	return s.host
+}
+
+// Item returns the issue or pull request for the reference.
+func (s *giteaSource) Item(ctx context.Context, ref reference) (*item, error) {
+	s.log.Debugf("getting issue %s", ref)
+
+	path := "repos/" + url.PathEscape(ref.Owner) + "/" + url.PathEscape(ref.Repo) + "/issues/" + strconv.Itoa(ref.Number)
+
+	var issue giteaIssue
+	if _, err := s.api.get(ctx, path, nil, &issue); err != nil {
+		return nil, err
+	}
+
+	return s.item(ref.Owner, ref.Repo, issue), nil
+}
+
+// Repositories returns the repositories for the orgs.
+func (s *giteaSource) Repositories(ctx context.Context) ([]repository, error) {
+	if len(s.orgs) == 0 {
+		s.log.Infof("getting repositories to be autofilled for %s...", s.host)
+		return s.getRepositories(ctx, "user/repos")
+	}
+
+	s.log.Infof("getting repositories to be autofilled for org[s]: %s...", strings.Join(s.orgs, ", "))
+	repos := []repository{}
+	for _, org := range s.orgs {
+		r, err := s.getRepositories(ctx, "orgs/"+url.PathEscape(org)+"/repos")
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, r...)
+	}
+	return repos, nil
+}
+
+// WatchedRepositories returns the repositories watched by the user.
+func (s *giteaSource) WatchedRepositories(ctx context.Context) ([]repository, error) {
+	s.log.Infof("getting repositories watched on %s...", s.host)
+	return s.getRepositories(ctx, "user/subscriptions")
+}
+
+// StarredRepositories returns the repositories starred by the user, or by the
+// token's user if user is empty.
+func (s *giteaSource) StarredRepositories(ctx context.Context, user string) ([]repository, error) {
+	s.log.Infof("getting repositories starred on %s...", s.host)
+	if len(user) < 1 {
+		return s.getRepositories(ctx, "user/starred")
+	}
+	return s.getRepositories(ctx, "users/"+url.PathEscape(user)+"/starred")
+}
+
+// Items returns the issues and pull requests for the repository.
+func (s *giteaSource) Items(ctx context.Context, repo repository, since time.Time) ([]*item, error) {
+	s.log.Debugf("getting issues for repo %s...", repo.FullName())
+
+	path := "repos/" + url.PathEscape(repo.Owner) + "/" + url.PathEscape(repo.Name) + "/issues"
+	query := url.Values{
+		"state": []string{"all"},
+		"since": []string{since.Format(time.RFC3339)},
+		"limit": []string{strconv.Itoa(giteaPerPage)},
+	}
+
+	items := []*item{}
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+
+		issues := []giteaIssue{}
+		if _, err := s.api.get(ctx, path, query, &issues); err != nil {
+			return nil, err
+		}
+		for _, issue := range issues {
+			items = append(items, s.item(repo.Owner, repo.Name, issue))
+		}
+
+		// Stop at the first empty page. A page with less than the limit is
+		// not the last one, since the server can cap the page size lower.
+		if len(issues) == 0 {
+			return items, nil
+		}
+	}
+}
+
+func (s *giteaSource) getRepositories(ctx context.Context, path string) ([]repository, error) {
+	query := url.Values{"limit": []string{strconv.Itoa(giteaPerPage)}}
+
+	repos := []repository{}
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+
+		r := []giteaRepository{}
+		if _, err := s.api.get(ctx, path, query, &r); err != nil {
+			return nil, err
+		}
+		for _, repo := range r {
+			visibility := "public"
+			switch {
+			case repo.Private:
+				visibility = "private"
+			case repo.Internal:
+				visibility = "internal"
+			}
+			repos = append(repos, repository{
+				Host:       s.host,
+				Owner:      repo.Owner.Login,
+				Name:       repo.Name,
+				Topics:     repo.Topics,
+				Visibility: visibility,
+				Fork:       repo.Fork,
+				Archived:   repo.Archived,
+			})
+		}
+
+		// Stop at the first empty page. A page with less than the limit is
+		// not the last one, since the server can cap the page size lower.
+		if len(r) == 0 {
+			return repos, nil
+		}
+	}
+}
+
+// item normalizes a Gitea issue or pull request.
+func (s *giteaSource) item(owner, repo string, issue giteaIssue) *item {
+	ref := reference{
+		Host:   s.host,
+		Owner:  owner,
+		Repo:   repo,
+		Number: issue.Number,
+	}
+
+	labels := []string{}
+	for _, label := range issue.Labels {
+		labels = append(labels, label.Name)
+	}
+
+	assignees := []string{}
+	for _, assignee := range issue.Assignees {
+		assignees = append(assignees, assignee.Login)
+	}
+
+	var milestone string
+	var due time.Time
+	if issue.Milestone != nil {
+		milestone = issue.Milestone.Title
+		if issue.Milestone.DueOn != nil {
+			due = *issue.Milestone.DueOn
+		}
+	}
+
+	var completed time.Time
+	if issue.ClosedAt != nil {
+		completed = *issue.ClosedAt
+	}
+
+	state := issue.State
+	issueType := "issue"
+	if issue.PullRequest != nil {
+		issueType = "pull request"
+		if issue.PullRequest.Merged {
+			state = "merged"
+			if issue.PullRequest.MergedAt != nil {
+				completed = *issue.PullRequest.MergedAt
+			}
+		}
+	}
+
+	return &item{
+		ref:   ref,
+		raw:   issue,
+		draft: issue.PullRequest != nil && issue.PullRequest.Draft,
+		fields: Fields{
+			Reference:        ref.String(),
+			Title:            issue.Title,
+			State:            state,
+			Author:           issue.User.Login,
+			Type:             issueType,
+			Labels:           labels,
+			Assignees:        assignees,
+			Milestone:        milestone,
+			MilestoneDueDate: due,
+			Comments:         issue.Comments,
+			URL:              issue.HTMLURL,
+			Updated:          issue.UpdatedAt,
+			Created:          issue.CreatedAt,
+			Completed:        completed,
+			Repository:       repo,
+		},
+	}
+}
@@ -0,0 +1,658 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/sirupsen/logrus"
+)
+
+// githubSource is a Source for GitHub and GitHub Enterprise.
+type githubSource struct {
+	client      *github.Client
+	orgs        []string
+	affiliation string
+	// orgType has autofill list the repositories of the orgs with the type,
+	// like all or sources, instead of those of the user with the
+	// affiliation.
+	orgType string
+	// teams have autofill list the repositories of the teams too, in the
+	// format {org}/{team-slug}.
+	teams []string
+
+	// graphql is used to fetch issues and pull requests, if set.
+	graphql *githubGraphQLClient
+	// drafts has us find out which open pull requests are drafts, the REST
+	// API takes a request for each of them.
+	drafts bool
+
+	// log is the logger of the job the source fetches for.
+	log *logrus.Entry
+}
+
+// githubTopicsMediaType has the REST API return the topics of repositories,
+// older GitHub Enterprise servers only do with it.
+const githubTopicsMediaType = "application/vnd.github.mercy-preview+json"
+
+// githubRepository is a repository from the REST API, along with the
+// visibility the client does not know about.
+type githubRepository struct {
+	github.Repository
+	// Visibility is public, private or internal, servers without internal
+	// repositories leave it out.
+	Visibility string `json:"visibility"`
+}
+
+// repository returns the repository for autofill.
+func (r githubRepository) repository() repository {
+	visibility := r.Visibility
+	if visibility == "" {
+		visibility = "public"
+		if r.GetPrivate() {
+			visibility = "private"
+		}
+	}
+
+	return repository{
+		Owner:      r.GetOwner().GetLogin(),
+		Name:       r.GetName(),
+		Topics:     r.Topics,
+		Visibility: visibility,
+		Fork:       r.GetFork(),
+		Archived:   r.GetArchived(),
+	}
+}
+
+// newGitHubSource creates a new source that autofills the repositories for
+// the orgs with the given affiliation, logging to log.
+func newGitHubSource(client *github.Client, orgs []string, affiliation string, log *logrus.Entry) *githubSource {
+	return &githubSource{
+		client:      client,
+		orgs:        orgs,
+		affiliation: affiliation,
+		log:         log,
+	}
+}
+
+// Host returns an empty string since GitHub is the default source.
+func (s *githubSource) Host() string {
+	return ""
+}
+
+// Item returns the issue or pull request for the reference.
+func (s *githubSource) Item(ctx context.Context, ref reference) (*item, error) {
+	s.log.Debugf("getting issue %s", ref)
+	var issue *github.Issue
+	resp, err := s.do(ctx, func() (resp *github.Response, err error) {
+		issue, resp, err = s.client.Issues.Get(ctx, ref.Owner, ref.Repo, ref.Number)
+		return resp, err
+	})
+	if err != nil {
+		// Deleted issues are gone, the rest are not found.
+		if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone) {
+			return nil, errNotFound
+		}
+		return nil, err
+	}
+
+	// GitHub redirects us to where the issue is now if it was transferred,
+	// or its repository renamed.
+	owner, repo := ref.Owner, ref.Repo
+	if issue.GetRepositoryURL() != "" {
+		owner, repo, err = issueRepository(issue)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if moved := (reference{Owner: owner, Repo: repo, Number: issue.GetNumber()}); moved != ref {
+		s.log.Infof("issue %s moved to %s", ref, moved)
+	}
+
+	return s.item(ctx, owner, repo, issue)
+}
+
+// BatchItems returns the issues and pull requests for the references using the
+// GraphQL API, if it is enabled. References missing from the map returned
+// could not be fetched and should be fetched one by one instead.
+func (s *githubSource) BatchItems(ctx context.Context, refs []reference) (map[string]*item, error) {
+	items := map[string]*item{}
+	if !s.graphql.enabled() {
+		return items, nil
+	}
+
+	var mu sync.Mutex
+	batches := (len(refs) + graphqlBatchSize - 1) / graphqlBatchSize
+	errs := forEach(ctx, batches, concurrency, func(n int) error {
+		end := (n + 1) * graphqlBatchSize
+		if end > len(refs) {
+			end = len(refs)
+		}
+		batch, err := s.graphql.items(ctx, refs[n*graphqlBatchSize:end])
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for k, v := range batch {
+			items[k] = v
+		}
+		return nil
+	})
+	for _, err := range errs {
+		if err != nil {
+			s.log.Warnf("fetching issues with the GitHub GraphQL API failed, falling back to the REST API: %v", err)
+			break
+		}
+	}
+
+	return items, nil
+}
+
+// Repositories returns the repositories for the orgs and teams.
+func (s *githubSource) Repositories(ctx context.Context) ([]repository, error) {
+	repos, err := s.orgRepositories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.teams) > 0 {
+		s.log.Infof("getting repositories to be autofilled for team[s]: %s...", strings.Join(s.teams, ", "))
+	}
+	seen := map[string]bool{}
+	for _, repo := range repos {
+		seen[repo.String()] = true
+	}
+	for _, team := range s.teams {
+		path, err := githubTeamPath(team)
+		if err != nil {
+			return nil, err
+		}
+		r, err := s.getRepositories(ctx, path+"/repos", url.Values{}, 1, 100, nil)
+		if err != nil {
+			return nil, fmt.Errorf("listing repositories for team %s failed: %v", team, err)
+		}
+		for _, repo := range r {
+			// Teams can share repositories with each other and the orgs.
+			if !seen[repo.String()] {
+				seen[repo.String()] = true
+				repos = append(repos, repo)
+			}
+		}
+	}
+	return repos, nil
+}
+
+// TeamMembers returns the members of the teams, or nil if there are no teams.
+func (s *githubSource) TeamMembers(ctx context.Context) ([]string, error) {
+	if len(s.teams) < 1 {
+		return nil, nil
+	}
+
+	s.log.Infof("getting members for team[s]: %s...", strings.Join(s.teams, ", "))
+	members := []string{}
+	for _, team := range s.teams {
+		path, err := githubTeamPath(team)
+		if err != nil {
+			return nil, err
+		}
+		members, err = s.getTeamMembers(ctx, path+"/members", 1, 100, members)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return members, nil
+}
+
+// orgRepositories returns the repositories for the orgs.
+func (s *githubSource) orgRepositories(ctx context.Context) ([]repository, error) {
+	if len(s.orgs) < 1 {
+		return []repository{}, nil
+	}
+
+	s.log.Infof("getting repositories to be autofilled for org[s]: %s...", strings.Join(s.orgs, ", "))
+	if len(s.orgType) < 1 {
+		query := url.Values{"affiliation": []string{s.affiliation}}
+		r, err := s.getRepositories(ctx, "user/repos", query, 1, 100, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		repos := []repository{}
+		for _, repo := range r {
+			if in(s.orgs, repo.Owner) {
+				repos = append(repos, repo)
+			}
+		}
+		return repos, nil
+	}
+
+	repos := []repository{}
+	for _, org := range s.orgs {
+		// This is the same request as Repositories.ListByOrg, which drops
+		// the visibility of the repositories.
+		query := url.Values{"type": []string{s.orgType}}
+		r, err := s.getRepositories(ctx, "orgs/"+url.PathEscape(org)+"/repos", query, 1, 100, nil)
+		if err == errNotFound {
+			// The org is a user, they only have the owner repositories.
+			s.log.Debugf("org %s not found, listing its repositories as a user", org)
+			r, err = s.getRepositories(ctx, "users/"+url.PathEscape(org)+"/repos", url.Values{"type": []string{"owner"}}, 1, 100, nil)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("listing repositories for org %s failed: %v", org, err)
+		}
+		repos = append(repos, r...)
+	}
+	return repos, nil
+}
+
+// WatchedRepositories returns the repositories watched by the user.
+func (s *githubSource) WatchedRepositories(ctx context.Context) ([]repository, error) {
+	s.log.Info("getting repositories watched...")
+	return s.getWatchedRepositories(ctx, 1, 100, nil)
+}
+
+// StarredRepositories returns the repositories starred by the user, or by the
+// token's user if user is empty.
+func (s *githubSource) StarredRepositories(ctx context.Context, user string) ([]repository, error) {
+	s.log.Info("getting repositories starred...")
+	return s.getStarredRepositories(ctx, user, 1, 100, nil)
+}
+
+// githubInboxFilters are the filters for the issues the user is involved in.
+var githubInboxFilters = []string{"created", "assigned", "mentioned", "subscribed"}
+
+// Inbox returns the open issues and pull requests the user created, is
+// assigned to, is mentioned in or is subscribed to, and the pull requests
+// the user was asked to review.
+func (s *githubSource) Inbox(ctx context.Context) ([]*item, error) {
+	s.log.Info("getting issues the user is involved in...")
+
+	seen := map[string]bool{}
+	items := []*item{}
+	for _, filter := range githubInboxFilters {
+		r, err := s.getInboxIssues(ctx, filter, 1, 100, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range r {
+			if !seen[i.ref.String()] {
+				seen[i.ref.String()] = true
+				items = append(items, i)
+			}
+		}
+	}
+
+	// Review requests are not one of the filters, only search has them.
+	r, err := s.Search(ctx, "is:open is:pr review-requested:@me")
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range r {
+		if !seen[i.ref.String()] {
+			seen[i.ref.String()] = true
+			items = append(items, i)
+		}
+	}
+
+	return items, nil
+}
+
+// Items returns the issues and pull requests for the repository.
+func (s *githubSource) Items(ctx context.Context, repo repository, since time.Time) ([]*item, error) {
+	s.log.Debugf("getting issues for repo %s...", repo.FullName())
+	if s.graphql.enabled() {
+		items, err := s.graphql.repositoryItems(ctx, repo.Owner, repo.Name, since)
+		if err != errGraphQLUnsupported {
+			return items, err
+		}
+		// The server does not support the query, fall back to the REST API.
+	}
+	return s.getIssues(ctx, 0, 100, repo.Owner, repo.Name, since, nil)
+}
+
+func (s *githubSource) getRepositories(ctx context.Context, path string, query url.Values, page, perPage int, repos []repository) ([]repository, error) {
+	// The repositories are listed with our own request, since the client
+	// drops their visibility.
+	query.Set("page", strconv.Itoa(page))
+	query.Set("per_page", strconv.Itoa(perPage))
+	req, err := s.client.NewRequest(http.MethodGet, path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", githubTopicsMediaType)
+
+	var r []githubRepository
+	resp, err := s.do(ctx, func() (*github.Response, error) {
+		return s.client.Do(ctx, req, &r)
+	})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, errNotFound
+		}
+		return nil, err
+	}
+
+	for _, repo := range r {
+		repos = append(repos, repo.repository())
+	}
+
+	// Return early if we are on the last page.
+	if page == resp.LastPage || resp.NextPage == 0 {
+		return repos, nil
+	}
+
+	page = resp.NextPage
+	return s.getRepositories(ctx, path, query, page, perPage, repos)
+}
+
+func (s *githubSource) getTeamMembers(ctx context.Context, path string, page, perPage int, members []string) ([]string, error) {
+	query := url.Values{
+		"page":     []string{strconv.Itoa(page)},
+		"per_page": []string{strconv.Itoa(perPage)},
+	}
+	req, err := s.client.NewRequest(http.MethodGet, path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []*github.User
+	resp, err := s.do(ctx, func() (*github.Response, error) {
+		return s.client.Do(ctx, req, &users)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		// Users can be members of more than one of the teams.
+		if !in(members, user.GetLogin()) {
+			members = append(members, user.GetLogin())
+		}
+	}
+
+	// Return early if we are on the last page.
+	if page == resp.LastPage || resp.NextPage == 0 {
+		return members, nil
+	}
+
+	page = resp.NextPage
+	return s.getTeamMembers(ctx, path, page, perPage, members)
+}
+
+// githubTeamPath returns the API path for the team in the format
+// {org}/{team-slug}. The client only knows the paths by team ID.
+func githubTeamPath(team string) (string, error) {
+	parts := strings.Split(team, "/")
+	if len(parts) != 2 || len(parts[0]) < 1 || len(parts[1]) < 1 {
+		return "", fmt.Errorf("team %s is not in the format {org}/{team-slug}", team)
+	}
+	return "orgs/" + url.PathEscape(parts[0]) + "/teams/" + url.PathEscape(parts[1]), nil
+}
+
+func (s *githubSource) getWatchedRepositories(ctx context.Context, page, perPage int, repos []repository) ([]repository, error) {
+	opt := &github.ListOptions{
+		Page:    page,
+		PerPage: perPage,
+	}
+
+	var r []*github.Repository
+	resp, err := s.do(ctx, func() (resp *github.Response, err error) {
+		r, resp, err = s.client.Activity.ListWatched(ctx, "", opt)
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, repo := range r {
+		repos = append(repos, githubRepository{Repository: *repo}.repository())
+	}
+
+	// Return early if we are on the last page.
+	if page == resp.LastPage || resp.NextPage == 0 {
+		return repos, nil
+	}
+
+	page = resp.NextPage
+	return s.getWatchedRepositories(ctx, page, perPage, repos)
+}
+
+func (s *githubSource) getStarredRepositories(ctx context.Context, user string, page, perPage int, repos []repository) ([]repository, error) {
+	opt := &github.ActivityListStarredOptions{
+		ListOptions: github.ListOptions{
+			Page:    page,
+			PerPage: perPage,
+		},
+	}
+
+	var r []*github.StarredRepository
+	resp, err := s.do(ctx, func() (resp *github.Response, err error) {
+		r, resp, err = s.client.Activity.ListStarred(ctx, user, opt)
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, starred := range r {
+		if starred.Repository == nil {
+			continue
+		}
+		repos = append(repos, githubRepository{Repository: *starred.Repository}.repository())
+	}
+
+	// Return early if we are on the last page.
+	if page == resp.LastPage || resp.NextPage == 0 {
+		return repos, nil
+	}
+
+	page = resp.NextPage
+	return s.getStarredRepositories(ctx, user, page, perPage, repos)
+}
+
+func (s *githubSource) getInboxIssues(ctx context.Context, filter string, page, perPage int, items []*item) ([]*item, error) {
+	opt := &github.IssueListOptions{
+		Filter: filter,
+		State:  "open",
+		ListOptions: github.ListOptions{
+			Page:    page,
+			PerPage: perPage,
+		},
+	}
+
+	var issues []*github.Issue
+	resp, err := s.do(ctx, func() (resp *github.Response, err error) {
+		issues, resp, err = s.client.Issues.List(ctx, true, opt)
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, issue := range issues {
+		i, err := s.item(ctx, issue.GetRepository().GetOwner().GetLogin(), issue.GetRepository().GetName(), issue)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+
+	// Return early if we are on the last page.
+	if page == resp.LastPage || resp.NextPage == 0 {
+		return items, nil
+	}
+
+	page = resp.NextPage
+	return s.getInboxIssues(ctx, filter, page, perPage, items)
+}
+
+func (s *githubSource) getIssues(ctx context.Context, page, perPage int, owner, repo string, since time.Time, items []*item) ([]*item, error) {
+	opt := &github.IssueListByRepoOptions{
+		State: "all",
+		Since: since,
+		ListOptions: github.ListOptions{
+			Page:    page,
+			PerPage: perPage,
+		},
+	}
+
+	var issues []*github.Issue
+	resp, err := s.do(ctx, func() (resp *github.Response, err error) {
+		issues, resp, err = s.client.Issues.ListByRepo(ctx, owner, repo, opt)
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, issue := range issues {
+		i, err := s.item(ctx, owner, repo, issue)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+
+	// Return early if we are on the last page.
+	if page == resp.LastPage || resp.NextPage == 0 {
+		return items, nil
+	}
+
+	page = resp.NextPage
+	return s.getIssues(ctx, page, perPage, owner, repo, since, items)
+}
+
+// item normalizes a GitHub issue or pull request fetched from the REST API.
+func (s *githubSource) item(ctx context.Context, owner, repo string, issue *github.Issue) (*item, error) {
+	merged := false
+	// If the status of a pull request is closed, we should find out if the
+	// _actual_ pull request status is "merged".
+	if issue.IsPullRequest() && issue.GetState() == "closed" {
+		_, err := s.do(ctx, func() (resp *github.Response, err error) {
+			merged, resp, err = s.client.PullRequests.IsMerged(ctx, owner, repo, issue.GetNumber())
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	i := newGitHubItem(owner, repo, issue, merged)
+
+	// The issue does not say if an open pull request is a draft, the pull
+	// request does.
+	if s.drafts && issue.IsPullRequest() && issue.GetState() == "open" {
+		req, err := s.client.NewRequest(http.MethodGet, fmt.Sprintf("repos/%s/%s/pulls/%d", owner, repo, issue.GetNumber()), nil)
+		if err != nil {
+			return nil, err
+		}
+		var pr struct {
+			Draft bool `json:"draft"`
+		}
+		if _, err := s.do(ctx, func() (*github.Response, error) {
+			return s.client.Do(ctx, req, &pr)
+		}); err != nil {
+			return nil, err
+		}
+		i.draft = pr.Draft
+	}
+
+	return i, nil
+}
+
+// newGitHubItem normalizes a GitHub issue or pull request, merged is whether
+// the pull request was merged.
+func newGitHubItem(owner, repo string, issue *github.Issue, merged bool) *item {
+	ref := reference{
+		Owner:  owner,
+		Repo:   repo,
+		Number: issue.GetNumber(),
+	}
+
+	// Iterate over the labels.
+	labels := []string{}
+	for _, label := range issue.Labels {
+		labels = append(labels, label.GetName())
+	}
+
+	assignees := []string{}
+	for _, assignee := range issue.Assignees {
+		assignees = append(assignees, assignee.GetLogin())
+	}
+
+	state := issue.GetState()
+	issueType := "issue"
+	if issue.IsPullRequest() {
+		issueType = "pull request"
+		if merged {
+			state = "merged"
+		}
+	}
+
+	return &item{
+		ref: ref,
+		raw: issue,
+		fields: Fields{
+			Reference:        ref.String(),
+			Title:            issue.GetTitle(),
+			State:            state,
+			Author:           issue.GetUser().GetLogin(),
+			Type:             issueType,
+			Labels:           labels,
+			Assignees:        assignees,
+			Milestone:        issue.GetMilestone().GetTitle(),
+			MilestoneDueDate: issue.GetMilestone().GetDueOn(),
+			Comments:         issue.GetComments(),
+			URL:              issue.GetHTMLURL(),
+			Updated:          issue.GetUpdatedAt(),
+			Created:          issue.GetCreatedAt(),
+			Completed:        issue.GetClosedAt(),
+			Repository:       repo,
+		},
+	}
+}
+
+// issueRepository returns the owner and name of the repository for an issue
+// from its API URL, which is where the issue is now if it was transferred or
+// its repository renamed.
+func issueRepository(issue *github.Issue) (string, string, error) {
+	parts := strings.Split(strings.TrimSuffix(issue.GetRepositoryURL(), "/"), "/")
+	if len(parts) < 2 {
+		return "", "", fmt.Errorf("could not parse repository from url %q for issue %d", issue.GetRepositoryURL(), issue.GetNumber())
+	}
+	return parts[len(parts)-2], parts[len(parts)-1], nil
+}
+
+// do calls the GitHub API with fn, waiting and retrying whenever we hit the
+// rate limit.
+func (s *githubSource) do(ctx context.Context, fn func() (*github.Response, error)) (*github.Response, error) {
+	for {
+		resp, err := fn()
+
+		var wait time.Duration
+		switch e := err.(type) {
+		case *github.RateLimitError:
+			wait = time.Until(e.Rate.Reset.Time)
+		case *github.AbuseRateLimitError:
+			wait = time.Minute
+			if e.RetryAfter != nil {
+				wait = *e.RetryAfter
+			}
+		default:
+			return resp, err
+		}
+
+		s.log.Warnf("hit the GitHub rate limit, waiting %s before retrying", wait)
+		if err := sleep(ctx, wait); err != nil {
+			return resp, err
+		}
+	}
+}
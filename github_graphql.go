@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/sirupsen/logrus"
+)
+
+// errGraphQLUnsupported is returned by the queries when the server does not
+// support them, the REST API has to be used instead.
+var errGraphQLUnsupported = errors.New("GitHub GraphQL API is not supported by the server")
+
+// graphqlBatchSize is the number of references we fetch in a single GraphQL
+// query.
+const graphqlBatchSize = 50
+
+// graphqlFragments holds the fields we fetch for issues and pull requests.
+const graphqlFragments = `
+fragment issueFields on Issue {
+  number title state url updatedAt createdAt closedAt
+  author { login }
+  labels(first: 100) { nodes { name } }
+  comments { totalCount }
+  assignees(first: 100) { nodes { login } }
+  milestone { number title state dueOn }
+  repository { name owner { login } }
+}
+fragment pullRequestFields on PullRequest {
+  number title state url updatedAt createdAt closedAt merged isDraft
+  author { login }
+  labels(first: 100) { nodes { name } }
+  comments { totalCount }
+  assignees(first: 100) { nodes { login } }
+  milestone { number title state dueOn }
+  repository { name owner { login } }
+}`
+
+// githubGraphQLClient fetches issues and pull requests from the GitHub GraphQL
+// API, which lets us get many of them, merged state included, in one request.
+type githubGraphQLClient struct {
+	api *apiClient
+	log *logrus.Entry
+
+	mu       sync.Mutex
+	disabled bool
+}
+
+// graphqlError defines an error returned by the GraphQL API.
+type graphqlError struct {
+	Type       string        `json:"type"`
+	Path       []interface{} `json:"path"`
+	Message    string        `json:"message"`
+	Extensions struct {
+		// Code is set for errors validating the query against the schema.
+		Code string `json:"code"`
+	} `json:"extensions"`
+}
+
+// graphqlNode defines the fields of an issue or pull request in the GraphQL
+// API.
+type graphqlNode struct {
+	Typename  string     `json:"__typename"`
+	Number    int        `json:"number"`
+	Title     string     `json:"title"`
+	State     string     `json:"state"`
+	URL       string     `json:"url"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ClosedAt  *time.Time `json:"closedAt"`
+	Merged    bool       `json:"merged"`
+	IsDraft   bool       `json:"isDraft"`
+	Author    *struct {
+		Login string `json:"login"`
+	} `json:"author"`
+	Labels struct {
+		Nodes []struct {
+			Name string `json:"name"`
+		} `json:"nodes"`
+	} `json:"labels"`
+	Comments struct {
+		TotalCount int `json:"totalCount"`
+	} `json:"comments"`
+	Assignees struct {
+		Nodes []struct {
+			Login string `json:"login"`
+		} `json:"nodes"`
+	} `json:"assignees"`
+	// Repository is where the issue is now, which is not where we asked for
+	// it if the repository was renamed.
+	Repository *struct {
+		Name  string `json:"name"`
+		Owner struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+	} `json:"repository"`
+	Milestone *struct {
+		Number int        `json:"number"`
+		Title  string     `json:"title"`
+		State  string     `json:"state"`
+		DueOn  *time.Time `json:"dueOn"`
+	} `json:"milestone"`
+}
+
+// graphqlConnection defines a page of issues or pull requests.
+type graphqlConnection struct {
+	PageInfo struct {
+		HasNextPage bool   `json:"hasNextPage"`
+		EndCursor   string `json:"endCursor"`
+	} `json:"pageInfo"`
+	Nodes []graphqlNode `json:"nodes"`
+}
+
+// newGitHubGraphQLClient creates a new GraphQL client for the GitHub client,
+// logging to log. The http client must already be authenticated.
+func newGitHubGraphQLClient(client *github.Client, httpClient *http.Client, log *logrus.Entry) (*githubGraphQLClient, error) {
+	// The GraphQL API lives at /graphql for github.com and at /api/graphql
+	// for GitHub Enterprise, where the REST API is at /api/v3/.
+	base := strings.TrimSuffix(client.BaseURL.String(), "v3/")
+
+	api, err := newAPIClient(base, nil, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	api.log = log
+
+	return &githubGraphQLClient{api: api, log: log}, nil
+}
+
+// enabled returns whether the server supports the queries we need.
+func (g *githubGraphQLClient) enabled() bool {
+	if g == nil {
+		return false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return !g.disabled
+}
+
+// disable turns off GraphQL for the rest of the process, since the server does
+// not support it.
+func (g *githubGraphQLClient) disable(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.disabled {
+		g.log.Warnf("GitHub GraphQL API is not supported by the server, falling back to the REST API: %v", err)
+	}
+	g.disabled = true
+}
+
+// query sends the query and decodes the data into v. The errors for missing
+// nodes are returned separately, every other error means the query failed.
+func (g *githubGraphQLClient) query(ctx context.Context, query string, variables map[string]interface{}, v interface{}) ([]graphqlError, error) {
+	body := map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	}
+
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []graphqlError  `json:"errors"`
+	}
+	if _, err := g.api.do(ctx, http.MethodPost, "graphql", nil, body, &resp); err != nil {
+		if err == errNotFound {
+			// There is no GraphQL endpoint.
+			g.disable(err)
+			return nil, errGraphQLUnsupported
+		}
+		return nil, err
+	}
+
+	notFound := []graphqlError{}
+	for _, e := range resp.Errors {
+		if e.Type == "NOT_FOUND" {
+			notFound = append(notFound, e)
+			continue
+		}
+		err := fmt.Errorf("graphql query failed: %s", e.Message)
+		if e.Extensions.Code != "" {
+			// The schema is missing something we need, this is an older
+			// GitHub Enterprise server.
+			g.disable(err)
+			return nil, errGraphQLUnsupported
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(resp.Data, v); err != nil {
+		return nil, err
+	}
+	return notFound, nil
+}
+
+// items fetches the issues and pull requests for the references. References
+// that come back as null are missing from the map returned.
+func (g *githubGraphQLClient) items(ctx context.Context, refs []reference) (map[string]*item, error) {
+	// Group the references by repository so each repository is only
+	// looked up once.
+	repos := map[string][]reference{}
+	names := []string{}
+	for _, ref := range refs {
+		name := ref.Owner + "/" + ref.Repo
+		if _, ok := repos[name]; !ok {
+			names = append(names, name)
+		}
+		repos[name] = append(repos[name], ref)
+	}
+	sort.Strings(names)
+
+	var q strings.Builder
+	q.WriteString("query {\n")
+	for n, name := range names {
+		r := repos[name]
+		fmt.Fprintf(&q, "  r%d: repository(owner: %s, name: %s) {\n", n, strconv.Quote(r[0].Owner), strconv.Quote(r[0].Repo))
+		for _, ref := range r {
+			fmt.Fprintf(&q, "    i%d: issueOrPullRequest(number: %d) { __typename ...issueFields ...pullRequestFields }\n", ref.Number, ref.Number)
+		}
+		q.WriteString("  }\n")
+	}
+	q.WriteString("}\n")
+	q.WriteString(graphqlFragments)
+
+	data := map[string]map[string]*graphqlNode{}
+	if _, err := g.query(ctx, q.String(), nil, &data); err != nil {
+		return nil, err
+	}
+
+	items := map[string]*item{}
+	for n, name := range names {
+		nodes := data["r"+strconv.Itoa(n)]
+		for _, ref := range repos[name] {
+			// A missing repository or issue comes back as null. It might have
+			// been transferred, which only the REST API follows, so leave it
+			// for Item.
+			node := nodes["i"+strconv.Itoa(ref.Number)]
+			if node == nil {
+				continue
+			}
+			items[ref.String()] = node.item(ref.Owner, ref.Repo)
+		}
+	}
+
+	return items, nil
+}
+
+// repositoryItems fetches the issues and pull requests for the repository
+// updated after since.
+func (g *githubGraphQLClient) repositoryItems(ctx context.Context, owner, repo string, since time.Time) ([]*item, error) {
+	items := []*item{}
+
+	// Issues can be filtered by since on the server.
+	const issuesQuery = `query($owner: String!, $name: String!, $since: DateTime, $after: String) {
+  repository(owner: $owner, name: $name) {
+    issues(first: 100, after: $after, filterBy: {since: $since}, orderBy: {field: UPDATED_AT, direction: DESC}) {
+      pageInfo { hasNextPage endCursor }
+      nodes { __typename ...issueFields }
+    }
+  }
+}` + graphqlFragments
+
+	// Pull requests can not, but we sort them by when they were updated
+	// and stop once we get past since.
+	const pullRequestsQuery = `query($owner: String!, $name: String!, $after: String) {
+  repository(owner: $owner, name: $name) {
+    pullRequests(first: 100, after: $after, orderBy: {field: UPDATED_AT, direction: DESC}) {
+      pageInfo { hasNextPage endCursor }
+      nodes { __typename ...pullRequestFields }
+    }
+  }
+}` + graphqlFragments
+
+	for _, query := range []string{issuesQuery, pullRequestsQuery} {
+		variables := map[string]interface{}{
+			"owner": owner,
+			"name":  repo,
+			"since": since.Format(time.RFC3339),
+		}
+		if query == pullRequestsQuery {
+			delete(variables, "since")
+		}
+
+		for {
+			var data struct {
+				Repository *struct {
+					Issues       *graphqlConnection `json:"issues"`
+					PullRequests *graphqlConnection `json:"pullRequests"`
+				} `json:"repository"`
+			}
+			notFound, err := g.query(ctx, query, variables, &data)
+			if err != nil {
+				return nil, err
+			}
+			if len(notFound) > 0 || data.Repository == nil {
+				return nil, errNotFound
+			}
+
+			conn := data.Repository.Issues
+			if conn == nil {
+				conn = data.Repository.PullRequests
+			}
+
+			done := !conn.PageInfo.HasNextPage
+			for _, node := range conn.Nodes {
+				if node.UpdatedAt.Before(since) {
+					done = true
+					break
+				}
+				items = append(items, node.item(owner, repo))
+			}
+			if done {
+				break
+			}
+			variables["after"] = conn.PageInfo.EndCursor
+		}
+	}
+
+	return items, nil
+}
+
+// item normalizes the node.
+func (n *graphqlNode) item(owner, repo string) *item {
+	if n.Repository != nil {
+		owner, repo = n.Repository.Owner.Login, n.Repository.Name
+	}
+	issue, merged := n.issue()
+	i := newGitHubItem(owner, repo, issue, merged)
+	i.draft = n.IsDraft
+	return i
+}
+
+// issue converts the node into the REST API's issue, so the rest of the
+// source can treat both the same. It also returns whether a pull request was
+// merged.
+func (n *graphqlNode) issue() (*github.Issue, bool) {
+	// The GraphQL API has a separate merged state, the REST API calls those
+	// closed.
+	state := strings.ToLower(n.State)
+	if state == "merged" {
+		state = "closed"
+	}
+
+	issue := &github.Issue{
+		Number:    github.Int(n.Number),
+		Title:     github.String(n.Title),
+		State:     github.String(state),
+		HTMLURL:   github.String(n.URL),
+		Comments:  github.Int(n.Comments.TotalCount),
+		UpdatedAt: &n.UpdatedAt,
+		CreatedAt: &n.CreatedAt,
+		ClosedAt:  n.ClosedAt,
+	}
+	if n.Author != nil {
+		issue.User = &github.User{Login: github.String(n.Author.Login)}
+	}
+	for _, label := range n.Labels.Nodes {
+		issue.Labels = append(issue.Labels, github.Label{Name: github.String(label.Name)})
+	}
+	for _, assignee := range n.Assignees.Nodes {
+		issue.Assignees = append(issue.Assignees, &github.User{Login: github.String(assignee.Login)})
+	}
+	if n.Milestone != nil {
+		issue.Milestone = &github.Milestone{
+			Number: github.Int(n.Milestone.Number),
+			Title:  github.String(n.Milestone.Title),
+			State:  github.String(strings.ToLower(n.Milestone.State)),
+			DueOn:  n.Milestone.DueOn,
+		}
+	}
+	if n.Typename == "PullRequest" {
+		issue.PullRequestLinks = &github.PullRequestLinks{HTMLURL: github.String(n.URL)}
+	}
+
+	return issue, n.Merged
+}
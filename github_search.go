@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const (
+	// searchResultsLimit is the most results the search API returns for a
+	// query, no matter how many pages we ask for.
+	searchResultsLimit = 1000
+	// searchPerPage is the most results the search API returns per page.
+	searchPerPage = 100
+)
+
+// searchEpoch is the start of the first created date window, nothing on
+// GitHub was created before it.
+var searchEpoch = time.Date(2008, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Search returns the issues and pull requests matching the search query.
+//
+// The search API only returns the first 1000 results for a query, so when a
+// query matches more than that we split it into windows by created date
+// until every window fits.
+func (s *githubSource) Search(ctx context.Context, query string) ([]*item, error) {
+	s.log.Infof("getting issues for search %q...", query)
+
+	if strings.Contains(query, "created:") {
+		// We can not add our own created windows to the query.
+		items, total, err := s.searchWindow(ctx, query, false)
+		if err != nil {
+			return nil, err
+		}
+		if total > searchResultsLimit {
+			s.log.Warnf("search %q matches %d results, only the first %d can be fetched when the query filters by created date", query, total, searchResultsLimit)
+		}
+		return items, nil
+	}
+
+	return s.searchCreated(ctx, query, searchEpoch, time.Now().UTC())
+}
+
+// searchCreated returns the results for the query created between from and
+// to, splitting the window in two if it has too many results.
+func (s *githubSource) searchCreated(ctx context.Context, query string, from, to time.Time) ([]*item, error) {
+	q := fmt.Sprintf("%s created:%s..%s", query, from.Format(time.RFC3339), to.Format(time.RFC3339))
+
+	// A window of a second can not be split any further.
+	split := to.Sub(from) > time.Second
+	items, total, err := s.searchWindow(ctx, q, split)
+	if err != nil {
+		return nil, err
+	}
+	if total <= searchResultsLimit || !split {
+		return items, nil
+	}
+
+	// The window has too many results, split it in half. The ranges are
+	// inclusive so the second half starts a second after the first ends.
+	mid := from.Add(to.Sub(from) / 2).Truncate(time.Second)
+	s.log.Debugf("search %q matches %d results, splitting it at %s", q, total, mid.Format(time.RFC3339))
+
+	first, err := s.searchCreated(ctx, query, from, mid)
+	if err != nil {
+		return nil, err
+	}
+	second, err := s.searchCreated(ctx, query, mid.Add(time.Second), to)
+	if err != nil {
+		return nil, err
+	}
+	return append(first, second...), nil
+}
+
+// searchWindow returns the results for the query, and the total number of
+// results it matches. If split is true and there are more results than the
+// search API returns, none are fetched since the caller will split the query
+// anyway.
+func (s *githubSource) searchWindow(ctx context.Context, query string, split bool) ([]*item, int, error) {
+	opt := &github.SearchOptions{
+		Sort:  "created",
+		Order: "asc",
+		ListOptions: github.ListOptions{
+			PerPage: searchPerPage,
+		},
+	}
+
+	items := []*item{}
+	for {
+		var result *github.IssuesSearchResult
+		resp, err := s.do(ctx, func() (resp *github.Response, err error) {
+			result, resp, err = s.client.Search.Issues(ctx, query, opt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+
+		total := result.GetTotal()
+		if split && total > searchResultsLimit {
+			return nil, total, nil
+		}
+
+		for n := range result.Issues {
+			issue := &result.Issues[n]
+			owner, repo, err := issueRepository(issue)
+			if err != nil {
+				return nil, 0, err
+			}
+			i, err := s.item(ctx, owner, repo, issue)
+			if err != nil {
+				return nil, 0, err
+			}
+			items = append(items, i)
+		}
+
+		if resp.NextPage == 0 {
+			return items, total, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeSearch is a GitHub search API for issues created at the given times,
+// which like the real one only returns the first 1000 results of a query.
+type fakeSearch struct {
+	srv     *httptest.Server
+	created []time.Time
+	// queries holds the created windows that were searched.
+	queries []string
+}
+
+func newFakeSearch(t *testing.T, created []time.Time) *fakeSearch {
+	f := &fakeSearch{created: created}
+	f.srv = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func (f *fakeSearch) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/search/issues" {
+		http.NotFound(w, r)
+		return
+	}
+
+	q := r.URL.Query().Get("q")
+	n := strings.Index(q, "created:")
+	if n < 0 {
+		http.Error(w, "expected a created window", http.StatusUnprocessableEntity)
+		return
+	}
+	f.queries = append(f.queries, q[n:])
+	window := strings.SplitN(strings.TrimPrefix(q[n:], "created:"), "..", 2)
+	from, _ := time.Parse(time.RFC3339, window[0])
+	to, _ := time.Parse(time.RFC3339, window[1])
+
+	matches := []int{}
+	for number, c := range f.created {
+		if !c.Before(from) && !c.After(to) {
+			matches = append(matches, number+1)
+		}
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	start, end := (page-1)*perPage, page*perPage
+	if end > len(matches) {
+		end = len(matches)
+	}
+	if end > searchResultsLimit {
+		end = searchResultsLimit
+	}
+
+	result := github.IssuesSearchResult{Total: github.Int(len(matches))}
+	for _, number := range matches[start:end] {
+		result.Issues = append(result.Issues, github.Issue{
+			Number:        github.Int(number),
+			State:         github.String("open"),
+			RepositoryURL: github.String(f.srv.URL + "/repos/jessfraz/gitable"),
+			CreatedAt:     &f.created[number-1],
+		})
+	}
+	if end < len(matches) && end < searchResultsLimit {
+		next := *r.URL
+		query := next.Query()
+		query.Set("page", strconv.Itoa(page+1))
+		next.RawQuery = query.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%s%s>; rel="next"`, f.srv.URL, next.RequestURI()))
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+func (f *fakeSearch) source(t *testing.T) *githubSource {
+	client := github.NewClient(f.srv.Client())
+	var err error
+	client.BaseURL, err = url.Parse(f.srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newGitHubSource(client, nil, "", logrus.NewEntry(logrus.StandardLogger()))
+}
+
+func TestSearchCreated(t *testing.T) {
+	start := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name    string
+		created func(n int) time.Time
+		total   int
+		// want is how many results we can get, less than total when more
+		// than 1000 were created in the same second.
+		want int
+	}{
+		{
+			name:    "fits",
+			created: func(n int) time.Time { return start.Add(time.Duration(n) * time.Hour) },
+			total:   900,
+			want:    900,
+		},
+		{
+			name:    "spread out",
+			created: func(n int) time.Time { return start.Add(time.Duration(n) * time.Hour) },
+			total:   2500,
+			want:    2500,
+		},
+		{
+			name: "bunched up",
+			created: func(n int) time.Time {
+				if n < 1500 {
+					return start.Add(time.Duration(n) * time.Second)
+				}
+				return start.AddDate(1, 0, 0).Add(time.Duration(n) * time.Millisecond)
+			},
+			total: 2500,
+			want:  2500,
+		},
+		{
+			name:    "same second",
+			created: func(n int) time.Time { return start },
+			total:   1200,
+			want:    searchResultsLimit,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			created := make([]time.Time, tc.total)
+			for n := range created {
+				created[n] = tc.created(n)
+			}
+			f := newFakeSearch(t, created)
+
+			items, err := f.source(t).searchCreated(context.Background(), "is:open", searchEpoch, time.Now().UTC())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(items) != tc.want {
+				t.Fatalf("expected %d results, got %d in %d queries", tc.want, len(items), len(f.queries))
+			}
+			seen := map[string]bool{}
+			for _, i := range items {
+				if seen[i.ref.String()] {
+					t.Fatalf("got %s more than once", i.ref)
+				}
+				seen[i.ref.String()] = true
+			}
+		})
+	}
+}
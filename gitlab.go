@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// gitlabSource is a Source for gitlab.com and self-managed GitLab instances.
+type gitlabSource struct {
+	api    *apiClient
+	host   string
+	groups []string
+	// log is the logger of the job the source fetches for.
+	log *logrus.Entry
+}
+
+// gitlabUser defines the user fields we use from the GitLab API.
+type gitlabUser struct {
+	Username string `json:"username"`
+}
+
+// gitlabProject defines the project fields we use from the GitLab API.
+type gitlabProject struct {
+	ID                int    `json:"id"`
+	Path              string `json:"path"`
+	PathWithNamespace string `json:"path_with_namespace"`
+	Namespace         struct {
+		FullPath string `json:"full_path"`
+	} `json:"namespace"`
+	Topics []string `json:"topics"`
+	// TagList holds the topics on servers older than 14.0.
+	TagList           []string `json:"tag_list"`
+	Visibility        string   `json:"visibility"`
+	ForkedFromProject *struct {
+		ID int `json:"id"`
+	} `json:"forked_from_project"`
+	Archived bool `json:"archived"`
+}
+
+// gitlabIssue defines the fields we use from GitLab issues and merge requests.
+type gitlabIssue struct {
+	IID       int          `json:"iid"`
+	Title     string       `json:"title"`
+	State     string       `json:"state"`
+	Author    gitlabUser   `json:"author"`
+	Assignees []gitlabUser `json:"assignees"`
+	Milestone *struct {
+		Title string `json:"title"`
+		// DueDate is a date without a time, like 2006-01-02.
+		DueDate string `json:"due_date"`
+	} `json:"milestone"`
+	Labels         []string   `json:"labels"`
+	UserNotesCount int        `json:"user_notes_count"`
+	WebURL         string     `json:"web_url"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ClosedAt       *time.Time `json:"closed_at"`
+	MergedAt       *time.Time `json:"merged_at"`
+	Draft          bool       `json:"draft"`
+	// WorkInProgress is what draft was called before GitLab 13.2.
+	WorkInProgress bool `json:"work_in_progress"`
+}
+
+// newGitLabSource creates a new source for the GitLab instance at baseURL that
+// autofills the projects in the groups, or the projects the user is a member
+// of if no groups are given.
+func newGitLabSource(baseURL, token string, groups []string, client *http.Client, log *logrus.Entry) (*gitlabSource, error) {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	if !strings.HasSuffix(baseURL, "/api/v4") {
+		baseURL += "/api/v4"
+	}
+
+	api, err := newAPIClient(baseURL, http.Header{"Private-Token": []string{token}}, client)
+	if err != nil {
+		return nil, err
+	}
+	api.log = log
+
+	return &gitlabSource{
+		api:    api,
+		host:   api.baseURL.Host,
+		groups: groups,
+		log:    log,
+	}, nil
+}
+
+// Host returns the host of the GitLab instance.
+func (s *gitlabSource) Host() string {
+	return s.host
+}
+
+// Item returns the issue or merge request for the reference.
+func (s *gitlabSource) Item(ctx context.Context, ref reference) (*item, error) {
+	s.log.Debugf("getting issue %s", ref)
+
+	kind := "issues"
+	if ref.MergeRequest {
+		kind = "merge_requests"
+	}
+	path := "projects/" + url.PathEscape(ref.Owner+"/"+ref.Repo) + "/" + kind + "/" + strconv.Itoa(ref.Number)
+
+	var issue gitlabIssue
+	if _, err := s.api.get(ctx, path, nil, &issue); err != nil {
+		return nil, err
+	}
+
+	return s.item(ref.Owner, ref.Repo, issue, ref.MergeRequest), nil
+}
+
+// Repositories returns the projects for the groups.
+func (s *gitlabSource) Repositories(ctx context.Context) ([]repository, error) {
+	if len(s.groups) == 0 {
+		s.log.Infof("getting projects to be autofilled for %s...", s.host)
+		query := url.Values{"membership": []string{"true"}}
+		return s.getProjects(ctx, "projects", query)
+	}
+
+	s.log.Infof("getting projects to be autofilled for group[s]: %s...", strings.Join(s.groups, ", "))
+	repos := []repository{}
+	for _, group := range s.groups {
+		query := url.Values{"include_subgroups": []string{"true"}}
+		r, err := s.getProjects(ctx, "groups/"+url.PathEscape(group)+"/projects", query)
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, r...)
+	}
+	return repos, nil
+}
+
+// Items returns the issues and merge requests for the project.
+func (s *gitlabSource) Items(ctx context.Context, repo repository, since time.Time) ([]*item, error) {
+	s.log.Debugf("getting issues for project %s...", repo.FullName())
+
+	items := []*item{}
+	for _, mr := range []bool{false, true} {
+		kind := "issues"
+		if mr {
+			kind = "merge_requests"
+		}
+		path := "projects/" + url.PathEscape(repo.FullName()) + "/" + kind
+		query := url.Values{
+			"scope":         []string{"all"},
+			"updated_after": []string{since.Format(time.RFC3339)},
+		}
+
+		for page := "1"; page != ""; {
+			query.Set("page", page)
+			query.Set("per_page", "100")
+
+			issues := []gitlabIssue{}
+			resp, err := s.api.get(ctx, path, query, &issues)
+			if err != nil {
+				return nil, err
+			}
+			for _, issue := range issues {
+				items = append(items, s.item(repo.Owner, repo.Name, issue, mr))
+			}
+
+			page = resp.Header.Get("X-Next-Page")
+		}
+	}
+
+	return items, nil
+}
+
+func (s *gitlabSource) getProjects(ctx context.Context, path string, query url.Values) ([]repository, error) {
+	repos := []repository{}
+	for page := "1"; page != ""; {
+		query.Set("page", page)
+		query.Set("per_page", "100")
+
+		projects := []gitlabProject{}
+		resp, err := s.api.get(ctx, path, query, &projects)
+		if err != nil {
+			return nil, err
+		}
+		for _, project := range projects {
+			topics := project.Topics
+			if len(topics) == 0 {
+				topics = project.TagList
+			}
+			repos = append(repos, repository{
+				Host:       s.host,
+				Owner:      project.Namespace.FullPath,
+				Name:       project.Path,
+				Topics:     topics,
+				Visibility: project.Visibility,
+				Fork:       project.ForkedFromProject != nil,
+				Archived:   project.Archived,
+			})
+		}
+
+		page = resp.Header.Get("X-Next-Page")
+	}
+	return repos, nil
+}
+
+// item normalizes a GitLab issue or merge request.
+func (s *gitlabSource) item(owner, repo string, issue gitlabIssue, mr bool) *item {
+	ref := reference{
+		Host:         s.host,
+		Owner:        owner,
+		Repo:         repo,
+		Number:       issue.IID,
+		MergeRequest: mr,
+	}
+
+	issueType := "issue"
+	if mr {
+		issueType = "merge request"
+	}
+
+	// Map the GitLab states onto the ones we use for GitHub.
+	state := issue.State
+	switch issue.State {
+	case "opened":
+		state = "open"
+	case "locked":
+		// A merge request is locked while it is being merged.
+		state = "open"
+	}
+
+	var completed time.Time
+	if issue.ClosedAt != nil {
+		completed = *issue.ClosedAt
+	}
+	if issue.MergedAt != nil {
+		completed = *issue.MergedAt
+	}
+
+	labels := issue.Labels
+	if labels == nil {
+		labels = []string{}
+	}
+
+	assignees := []string{}
+	for _, assignee := range issue.Assignees {
+		assignees = append(assignees, assignee.Username)
+	}
+
+	var milestone string
+	var due time.Time
+	if issue.Milestone != nil {
+		milestone = issue.Milestone.Title
+		if len(issue.Milestone.DueDate) > 0 {
+			d, err := time.Parse("2006-01-02", issue.Milestone.DueDate)
+			if err != nil {
+				s.log.Warnf("parsing due date %s of milestone %s failed: %v", issue.Milestone.DueDate, milestone, err)
+			}
+			due = d
+		}
+	}
+
+	return &item{
+		ref:   ref,
+		raw:   issue,
+		draft: mr && (issue.Draft || issue.WorkInProgress),
+		fields: Fields{
+			Reference:        ref.String(),
+			Title:            issue.Title,
+			State:            state,
+			Author:           issue.Author.Username,
+			Type:             issueType,
+			Labels:           labels,
+			Assignees:        assignees,
+			Milestone:        milestone,
+			MilestoneDueDate: due,
+			Comments:         issue.UserNotesCount,
+			URL:              issue.WebURL,
+			Updated:          issue.UpdatedAt,
+			Created:          issue.CreatedAt,
+			Completed:        completed,
+			Repository:       repo,
+		},
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newFakeGitLab starts a fake self-managed GitLab under /gitlab, serving the
+// issues and merge requests of the group/sub/project project.
+func newFakeGitLab(t *testing.T) (*httptest.Server, *gitlabSource) {
+	project := "/gitlab/api/v4/projects/" + url.PathEscape("group/sub/project")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Private-Token") != "token" {
+			http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.EscapedPath() {
+		case project + "/issues":
+			// Two pages of one issue each.
+			if r.URL.Query().Get("scope") != "all" || r.URL.Query().Get("updated_after") == "" {
+				http.Error(w, "missing query", http.StatusBadRequest)
+				return
+			}
+			switch r.URL.Query().Get("page") {
+			case "1":
+				w.Header().Set("X-Next-Page", "2")
+				fmt.Fprint(w, `[{"iid": 1, "title": "first", "state": "opened", "author": {"username": "jess"}, "labels": ["bug"]}]`)
+			case "2":
+				w.Header().Set("X-Next-Page", "")
+				fmt.Fprint(w, `[{"iid": 2, "title": "second", "state": "closed", "author": {"username": "jess"}, "closed_at": "2020-01-02T00:00:00Z", "milestone": {"title": "v1.0", "due_date": "2020-02-01"}}]`)
+			default:
+				http.Error(w, "unexpected page", http.StatusBadRequest)
+			}
+		case project + "/merge_requests":
+			fmt.Fprint(w, `[
+  {"iid": 1, "title": "opened", "state": "opened", "draft": true},
+  {"iid": 2, "title": "locked", "state": "locked"},
+  {"iid": 3, "title": "merged", "state": "merged", "merged_at": "2020-01-03T00:00:00Z", "closed_at": null},
+  {"iid": 4, "title": "closed", "state": "closed", "closed_at": "2020-01-04T00:00:00Z", "work_in_progress": true}
+]`)
+		case project + "/merge_requests/3":
+			fmt.Fprint(w, `{"iid": 3, "title": "merged", "state": "merged", "merged_at": "2020-01-03T00:00:00Z", "web_url": "https://gitlab.example.com/group/sub/project/-/merge_requests/3"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	src, err := newGitLabSource(srv.URL+"/gitlab/", "token", nil, srv.Client(), logrus.NewEntry(logrus.StandardLogger()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, src
+}
+
+func TestGitLabSourceItems(t *testing.T) {
+	srv, src := newFakeGitLab(t)
+
+	host := srv.Listener.Addr().String()
+	if src.Host() != host {
+		t.Fatalf("expected host %s, got %s", host, src.Host())
+	}
+
+	repo := repository{Host: host, Owner: "group/sub", Name: "project"}
+	items, err := src.Items(context.Background(), repo, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type want struct {
+		ref       string
+		state     string
+		issueType string
+		draft     bool
+		completed time.Time
+	}
+	wants := []want{
+		{ref: host + ":group/sub/project#1", state: "open", issueType: "issue"},
+		{ref: host + ":group/sub/project#2", state: "closed", issueType: "issue", completed: time.Date(2020, time.January, 2, 0, 0, 0, 0, time.UTC)},
+		{ref: host + ":group/sub/project!1", state: "open", issueType: "merge request", draft: true},
+		{ref: host + ":group/sub/project!2", state: "open", issueType: "merge request"},
+		{ref: host + ":group/sub/project!3", state: "merged", issueType: "merge request", completed: time.Date(2020, time.January, 3, 0, 0, 0, 0, time.UTC)},
+		{ref: host + ":group/sub/project!4", state: "closed", issueType: "merge request", draft: true, completed: time.Date(2020, time.January, 4, 0, 0, 0, 0, time.UTC)},
+	}
+	if len(items) != len(wants) {
+		t.Fatalf("expected %d items, got %d", len(wants), len(items))
+	}
+	for n, w := range wants {
+		i := items[n]
+		if i.ref.String() != w.ref || i.fields.Reference != w.ref {
+			t.Errorf("expected reference %s, got %s", w.ref, i.ref)
+		}
+		if i.fields.State != w.state {
+			t.Errorf("%s: expected state %s, got %s", w.ref, w.state, i.fields.State)
+		}
+		if i.fields.Type != w.issueType {
+			t.Errorf("%s: expected type %s, got %s", w.ref, w.issueType, i.fields.Type)
+		}
+		if i.draft != w.draft {
+			t.Errorf("%s: expected draft %t, got %t", w.ref, w.draft, i.draft)
+		}
+		if !i.fields.Completed.Equal(w.completed) {
+			t.Errorf("%s: expected completed %s, got %s", w.ref, w.completed, i.fields.Completed)
+		}
+	}
+
+	second := items[1].fields
+	if second.Milestone != "v1.0" || !second.MilestoneDueDate.Equal(time.Date(2020, time.February, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected milestone v1.0 due 2020-02-01, got %s due %s", second.Milestone, second.MilestoneDueDate)
+	}
+	if items[0].fields.Labels[0] != "bug" || items[1].fields.Labels == nil {
+		t.Errorf("expected the labels of the first issue and none for the second, got %v and %v", items[0].fields.Labels, items[1].fields.Labels)
+	}
+}
+
+func TestGitLabSourceItem(t *testing.T) {
+	srv, src := newFakeGitLab(t)
+	host := srv.Listener.Addr().String()
+
+	ref, err := parseReference(host + ":group/sub/project!3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := src.Item(context.Background(), ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.fields.State != "merged" || i.fields.Type != "merge request" {
+		t.Fatalf("expected a merged merge request, got %s %s", i.fields.State, i.fields.Type)
+	}
+
+	ref.Number = 5
+	if _, err := src.Item(context.Background(), ref); err != errNotFound {
+		t.Fatalf("expected errNotFound for a missing merge request, got %v", err)
+	}
+}
+
+func TestNewGitLabSourceBaseURL(t *testing.T) {
+	testCases := []struct {
+		baseURL string
+		want    string
+	}{
+		{baseURL: "https://gitlab.com", want: "https://gitlab.com/api/v4/"},
+		{baseURL: "https://gitlab.example.com/", want: "https://gitlab.example.com/api/v4/"},
+		{baseURL: "https://example.com/gitlab", want: "https://example.com/gitlab/api/v4/"},
+		{baseURL: "https://gitlab.example.com:8443/api/v4", want: "https://gitlab.example.com:8443/api/v4/"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.baseURL, func(t *testing.T) {
+			src, err := newGitLabSource(tc.baseURL, "token", nil, nil, logrus.NewEntry(logrus.StandardLogger()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := src.api.baseURL.String(); got != tc.want {
+				t.Fatalf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
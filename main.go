@@ -9,14 +9,14 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
-	"strconv"
+	"reflect"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
 
 	"golang.org/x/oauth2"
 
-	airtable "github.com/fabioberger/airtable-go"
 	"github.com/genuinetools/pkg/cli"
 	"github.com/google/go-github/github"
 	"github.com/gregjones/httpcache"
@@ -26,20 +26,44 @@ import (
 )
 
 var (
-	interval time.Duration
-	autofill bool
-	once     bool
-
-	githubToken string
-	enturl      string
-	orgs        stringSlice
-	watched     bool
-	watchSince  string
+	interval    time.Duration
+	autofill    bool
+	once        bool
+	concurrency int
+
+	githubToken   string
+	enturl        string
+	githubGraphQL bool
+	orgs          stringSlice
+	orgRepoType   string
+	teams         stringSlice
+	teamMembers   bool
+	watched       bool
+	starred       bool
+	starredUser   string
+	myWork        bool
+	watchSince    string
+	search        string
+
+	gitlabToken  string
+	gitlabURL    string
+	gitlabGroups stringSlice
+
+	giteaToken string
+	giteaURL   string
+	giteaOrgs  stringSlice
 
 	airtableAPIKey    string
 	airtableBaseID    string
 	airtableTableName string
 
+	stateFile  string
+	configFile string
+	fields     stringSlice
+
+	// jobs are the jobs to run, from the config file or the flags.
+	jobs []jobConfig
+
 	debug bool
 )
 
@@ -65,22 +89,50 @@ func main() {
 	p.GitCommit = version.GITCOMMIT
 	p.Version = version.VERSION
 
+	// Setup the commands.
+	p.Commands = []cli.Command{
+		&planCommand{},
+		&resetCommand{},
+		&serveCommand{},
+	}
+
 	// Setup the global flags.
 	p.FlagSet = flag.NewFlagSet("global", flag.ExitOnError)
 	p.FlagSet.DurationVar(&interval, "interval", time.Minute, "update interval (ex. 5ms, 10s, 1m, 3h)")
 	p.FlagSet.BoolVar(&autofill, "autofill", false, "autofill all pull requests and issues for a user [or orgs] to a table (defaults to current user unless --orgs is set)")
 	p.FlagSet.BoolVar(&once, "once", false, "run once and exit, do not run as a daemon")
+	p.FlagSet.IntVar(&concurrency, "concurrency", 4, "number of records to refresh in parallel")
 
 	p.FlagSet.StringVar(&githubToken, "github-token", os.Getenv("GITHUB_TOKEN"), "GitHub API token (or env var GITHUB_TOKEN)")
 	p.FlagSet.Var(&orgs, "orgs", "organizations to include (this option only applies to --autofill)")
+	p.FlagSet.Var(&teams, "teams", "GitHub teams to include, in the format {org}/{team-slug} (this option only applies to --autofill)")
+	p.FlagSet.BoolVar(&teamMembers, "team-members-only", false, "only autofill the issues and pull requests authored by or assigned to members of the --teams")
+	p.FlagSet.StringVar(&orgRepoType, "org-repo-type", "all", "type of repositories to include for --orgs: all, public, private, forks, sources, member or internal (GitHub Enterprise)")
+	p.FlagSet.BoolVar(&githubGraphQL, "github-graphql", false, "fetch GitHub issues and pull requests in batches with the GraphQL API, falls back to the REST API if the server does not support it")
 	p.FlagSet.StringVar(&enturl, "github-url", "", "Connect to a specific GitHub server, provide full API URL (ex. https://github.example.com/api/v3/)")
 
+	p.FlagSet.StringVar(&gitlabToken, "gitlab-token", os.Getenv("GITLAB_TOKEN"), "GitLab API token (or env var GITLAB_TOKEN)")
+	p.FlagSet.Var(&gitlabGroups, "gitlab-groups", "GitLab groups to include (this option only applies to --autofill)")
+	p.FlagSet.StringVar(&gitlabURL, "gitlab-url", "https://gitlab.com", "Connect to a specific GitLab server, for self-managed instances (ex. https://gitlab.example.com)")
+
+	p.FlagSet.StringVar(&giteaToken, "gitea-token", os.Getenv("GITEA_TOKEN"), "Gitea or Forgejo API token (or env var GITEA_TOKEN)")
+	p.FlagSet.Var(&giteaOrgs, "gitea-orgs", "Gitea or Forgejo organizations to include (this option only applies to --autofill)")
+	p.FlagSet.StringVar(&giteaURL, "gitea-url", "", "Connect to a Gitea or Forgejo server (ex. https://gitea.example.com)")
+
 	p.FlagSet.StringVar(&airtableAPIKey, "airtable-apikey", os.Getenv("AIRTABLE_APIKEY"), "Airtable API Key (or env var AIRTABLE_APIKEY)")
 	p.FlagSet.StringVar(&airtableBaseID, "airtable-baseid", os.Getenv("AIRTABLE_BASEID"), "Airtable Base ID (or env var AIRTABLE_BASEID)")
 	p.FlagSet.StringVar(&airtableTableName, "airtable-table", os.Getenv("AIRTABLE_TABLE"), "Airtable Table (or env var AIRTABLE_TABLE)")
 
 	p.FlagSet.BoolVar(&watched, "watched", false, "include the watched repositories")
-	p.FlagSet.StringVar(&watchSince, "watch-since", "2008-01-01T00:00:00Z", "defines the starting point of the issues been watched (format: 2006-01-02T15:04:05Z). defaults to no filter")
+	p.FlagSet.BoolVar(&starred, "starred", false, "include the starred repositories")
+	p.FlagSet.BoolVar(&myWork, "my-work", false, "include the open issues and pull requests the user for the GitHub token created, is assigned to, is mentioned in, is subscribed to or was asked to review, across all repositories")
+	p.FlagSet.StringVar(&starredUser, "starred-user", "", "user whose starred repositories to include, defaults to the user for the token (this option only applies to --starred)")
+	p.FlagSet.StringVar(&search, "search", "", "include the issues and pull requests matching the GitHub search query (ex. \"is:open label:bug org:genuinetools\")")
+	p.FlagSet.StringVar(&watchSince, "watch-since", "2008-01-01T00:00:00Z", "defines the starting point of the issues fetched for repositories without a cursor yet (format: 2006-01-02T15:04:05Z). defaults to no filter")
+
+	p.FlagSet.Var(&fields, "fields", "optional fields to sync as well, their columns have to be in the table: "+strings.Join(optionalFields, ", "))
+	p.FlagSet.StringVar(&configFile, "config", "", "config file describing the jobs to run, each syncing its own table, instead of the flags for a single table")
+	p.FlagSet.StringVar(&stateFile, "state-file", defaultStateFile(), "file to store the sync state, like the cursors for each repository, between runs")
 
 	p.FlagSet.BoolVar(&debug, "debug", false, "enable debug logging")
 	p.FlagSet.BoolVar(&debug, "d", false, "enable debug logging")
@@ -92,29 +144,55 @@ func main() {
 			logrus.SetLevel(logrus.DebugLevel)
 		}
 
-		if len(githubToken) < 1 {
-			return errors.New("gitHub token cannot be empty")
+		if len(githubToken) < 1 && len(gitlabToken) < 1 && len(giteaURL) < 1 {
+			return errors.New("gitHub token cannot be empty unless a GitLab token or Gitea URL is set")
+		}
+
+		if concurrency < 1 {
+			return errors.New("concurrency must be at least 1")
+		}
+
+		if !in(orgRepoTypes, orgRepoType) {
+			return fmt.Errorf("unknown --org-repo-type %s, expected one of %s", orgRepoType, strings.Join(orgRepoTypes, ", "))
+		}
+
+		for _, team := range teams {
+			if _, err := githubTeamPath(team); err != nil {
+				return err
+			}
+		}
+
+		for _, field := range fields {
+			if !in(optionalFields, field) {
+				return fmt.Errorf("unknown --fields %s, expected one of %s", field, strings.Join(optionalFields, ", "))
+			}
+		}
+
+		if _, err := time.Parse("2006-01-02T15:04:05Z", watchSince); err != nil {
+			return fmt.Errorf("parsing --watch-since failed: %v", err)
 		}
 
 		if len(airtableAPIKey) < 1 {
 			return errors.New("airtable API Key cannot be empty")
 		}
 
-		if len(airtableBaseID) < 1 {
-			return errors.New("airtable Base ID cannot be empty")
-		}
+		if len(configFile) < 1 {
+			if len(airtableBaseID) < 1 {
+				return errors.New("airtable Base ID cannot be empty")
+			}
 
-		if len(airtableTableName) < 1 {
-			return errors.New("airtable Table cannot be empty")
+			if len(airtableTableName) < 1 {
+				return errors.New("airtable Table cannot be empty")
+			}
 		}
 
-		return nil
+		var err error
+		jobs, err = loadJobs(configFile)
+		return err
 	}
 
 	// Set the main program action.
 	p.Action = func(ctx context.Context, args []string) error {
-		ticker := time.NewTicker(interval)
-
 		// On ^C, or SIGTERM handle exit.
 		signals := make(chan os.Signal, 1)
 		signal.Notify(signals, os.Interrupt)
@@ -124,27 +202,147 @@ func main() {
 		go func() {
 			for sig := range signals {
 				logrus.Infof("Received %s, exiting.", sig.String())
-				ticker.Stop()
 				cancel()
 				os.Exit(0)
 			}
 		}()
 
-		// Create the http client.
-		ts := oauth2.StaticTokenSource(
-			&oauth2.Token{AccessToken: githubToken},
-		)
-
-		// Create the HTTP cache.
-		cachePath := "/tmp/cache"
-		if err := os.MkdirAll(cachePath, 0777); err != nil {
+		bots, err := newBots(ctx)
+		if err != nil {
 			logrus.Fatal(err)
 		}
-		cache := diskcache.New(cachePath)
-		tr := httpcache.NewTransport(cache)
-		c := &http.Client{Transport: tr}
-		ctx = context.WithValue(ctx, oauth2.HTTPClient, c)
 
+		// If the user passed the once flag, just do the run once and exit.
+		if once {
+			// A failed job does not stop the others.
+			failed := false
+			for _, bot := range bots {
+				if err := bot.run(ctx); err != nil {
+					bot.log.Error(err)
+					failed = true
+					continue
+				}
+				bot.log.Infof("Updated airtable table %s for base %s", bot.job.Airtable.Table, bot.job.Airtable.BaseID)
+			}
+			if failed {
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+
+		// Every job runs on its own ticker.
+		for _, bot := range bots {
+			go bot.loop(ctx)
+		}
+		<-ctx.Done()
+		return nil
+	}
+
+	// Run our program.
+	p.Run()
+}
+
+// newBots creates a bot for each of the jobs. They share the sync state, so
+// they never write over each other's cursors, and the jobs on the same base
+// share its rate limit.
+func newBots(ctx context.Context) ([]*bot, error) {
+	// Load the sync state.
+	state, err := loadState(stateFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading sync state from %s failed: %v", stateFile, err)
+	}
+
+	bots := []*bot{}
+	limiters := map[string]*rateLimiter{}
+	for _, job := range jobs {
+		limiter, ok := limiters[job.Airtable.BaseID]
+		if !ok {
+			limiter = newRateLimiter(airtableRequestsPerSecond)
+			limiters[job.Airtable.BaseID] = limiter
+		}
+
+		bot, err := newBot(ctx, job, state, limiter)
+		if err != nil {
+			for _, l := range limiters {
+				l.stop()
+			}
+			return nil, fmt.Errorf("creating job %s failed: %v", job.Name, err)
+		}
+		bots = append(bots, bot)
+	}
+	return bots, nil
+}
+
+// newBot creates the bot for the job, with the sink for its table and the
+// sources configured by the flags. The sinks wait on the limiter of the base.
+func newBot(ctx context.Context, job jobConfig, state *syncState, limiter *rateLimiter) (*bot, error) {
+	// Create the http client.
+	ts := oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: githubToken},
+	)
+
+	// Create the HTTP cache.
+	cachePath := "/tmp/cache"
+	if err := os.MkdirAll(cachePath, 0777); err != nil {
+		return nil, err
+	}
+	cache := diskcache.New(cachePath)
+	tr := httpcache.NewTransport(cache)
+	c := &http.Client{Transport: tr}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, c)
+
+	// Parse the templates for the computed columns.
+	computed, err := parseComputed(job.Computed)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the airtable sink.
+	sink, err := newAirtableSink(airtableAPIKey, job.Airtable.BaseID, job.Airtable.Table, job.columns(), computedColumns(computed), limiter, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Link the records to the records in the projects table.
+	if job.Projects.enabled() {
+		sink.projects = newAirtableProjects(job.Projects.Table, job.Projects.nameColumn(), job.Projects.Create)
+	}
+	sink.collaborators = job.Collaborators
+
+	// Read the other columns to copy to the archive table, and create the
+	// sink for it. It shares the projects and the rate limit of the base.
+	var archive Sink
+	if job.Retention.Closed == retentionArchive {
+		sink.other = job.Retention.ArchiveColumns
+		a, err := newAirtableSink(airtableAPIKey, job.Airtable.BaseID, job.Retention.ArchiveTable, job.columns(), computedColumns(computed), limiter, nil)
+		if err != nil {
+			return nil, err
+		}
+		a.projects = sink.projects
+		a.collaborators = sink.collaborators
+		archive = a
+	}
+
+	// Create our bot type.
+	bot := &bot{
+		job:      job,
+		log:      logrus.WithField("job", job.Name),
+		computed: computed,
+		sink:     sink,
+		archive:  archive,
+		projects: sink.projects,
+		state:    state,
+		table:    stateTable(job.Airtable.BaseID, job.Airtable.Table),
+		// Initialize our map.
+		issues: map[string]*item{},
+	}
+
+	// A job that scopes autofill to orgs, teams or groups only autofills
+	// from the forges they are on. Otherwise every forge autofills the
+	// repositories of the user.
+	scoped := len(job.Orgs) > 0 || len(job.Teams) > 0 || len(job.GitLabGroups) > 0 || len(job.GiteaOrgs) > 0
+
+	if len(githubToken) > 0 {
 		// Create the github client.
 		tc := oauth2.NewClient(ctx, ts)
 		client := github.NewClient(tc)
@@ -152,393 +350,796 @@ func main() {
 			var err error
 			client.BaseURL, err = url.Parse(enturl + "/api/v3/")
 			if err != nil {
-				logrus.Fatal(err)
+				return nil, err
 			}
 		}
 
-		// Create the airtable client.
-		airtableClient, err := airtable.New(airtableAPIKey, airtableBaseID)
-		if err != nil {
-			logrus.Fatal(err)
-		}
+		orgs := append([]string{}, job.Orgs...)
 
-		// Affiliation must be set before we add the user to the "orgs".
-		affiliation := "owner,collaborator"
+		// If we got orgs explicitly passed, autofill all their repositories,
+		// not only the ones the user is a member of.
+		orgType := ""
 		if len(orgs) > 0 {
-			affiliation += ",organization_member"
+			orgType = job.OrgRepoType
 		}
 
-		// If we didn't get any orgs explicitly passed, use the current user.
-		if len(orgs) == 0 {
+		// If we didn't get any orgs or teams explicitly passed, and are
+		// autofilling, use the current user.
+		if job.Autofill && !scoped {
 			// Get the current user for the GitHub token.
 			user, _, err := client.Users.Get(ctx, "")
 			if err != nil {
-				logrus.Fatalf("getting current github user for token failed: %v", err)
+				return nil, fmt.Errorf("getting current github user for token failed: %v", err)
 			}
 			// Add the current user to orgs.
 			orgs = append(orgs, user.GetLogin())
 		}
 
-		// Create our bot type.
-		bot := &bot{
-			ghClient:       client,
-			airtableClient: airtableClient,
-			// Initialize our map.
-			issues: map[string]*github.Issue{},
+		src := newGitHubSource(client, orgs, "owner,collaborator", bot.log)
+		src.orgType = orgType
+		src.teams = job.Teams
+		src.drafts = job.Filters.Draft != nil
+		if githubGraphQL {
+			var err error
+			src.graphql, err = newGitHubGraphQLClient(client, tc, bot.log)
+			if err != nil {
+				return nil, err
+			}
 		}
+		bot.sources = append(bot.sources, src)
+		if !scoped || len(job.Orgs) > 0 || len(job.Teams) > 0 {
+			bot.autofill = append(bot.autofill, src)
+		}
+	}
 
-		// If the user passed the once flag, just do the run once and exit.
-		if once {
-			if err := bot.run(ctx, affiliation); err != nil {
-				logrus.Fatal(err)
-			}
-			logrus.Infof("Updated airtable table %s for base %s", airtableTableName, airtableBaseID)
-			os.Exit(0)
+	if len(gitlabToken) > 0 {
+		// Create the gitlab source.
+		src, err := newGitLabSource(gitlabURL, gitlabToken, job.GitLabGroups, c, bot.log)
+		if err != nil {
+			return nil, err
 		}
+		bot.sources = append(bot.sources, src)
+		if !scoped || len(job.GitLabGroups) > 0 {
+			bot.autofill = append(bot.autofill, src)
+		}
+	}
 
-		logrus.Infof("Starting bot to update airtable table %s for base %s every %s", airtableTableName, airtableBaseID, interval)
-		for range ticker.C {
-			if err := bot.run(ctx, affiliation); err != nil {
-				logrus.Fatal(err)
-			}
+	if len(giteaURL) > 0 {
+		// Create the gitea source.
+		src, err := newGiteaSource(giteaURL, giteaToken, job.GiteaOrgs, c, bot.log)
+		if err != nil {
+			return nil, err
+		}
+		bot.sources = append(bot.sources, src)
+		if !scoped || len(job.GiteaOrgs) > 0 {
+			bot.autofill = append(bot.autofill, src)
 		}
-		return nil
 	}
 
-	// Run our program.
-	p.Run()
+	return bot, nil
 }
 
 type bot struct {
-	ghClient       *github.Client
-	airtableClient *airtable.Client
-	issues         map[string]*github.Issue
+	job jobConfig
+	log *logrus.Entry
+	// computed are the computed columns for the job.
+	computed []computedColumn
+
+	// sources are all the configured forges, so the records for any of
+	// them can be refreshed. autofill are the ones the job autofills from.
+	sources  []Source
+	autofill []Source
+	sink     Sink
+	issues   map[string]*item
+	// archive is the sink closed records are archived to, if the job
+	// archives them.
+	archive Sink
+	// projects are the records in the projects table, if the job links
+	// records to projects.
+	projects *airtableProjects
+
+	// state holds the cursors keyed by table, it is shared by the jobs.
+	state *syncState
+	table string
+	// cursors holds the cursors advanced in the current run.
+	cursors map[string]time.Time
+
+	// records holds the records in the sink as of the last run, keyed by
+	// reference, so single issues can be refreshed in between runs.
+	records map[string]githubRecord
+	// scope holds the repositories the last run fetched the issues of, with
+	// the users the issues have to be authored by or assigned to, or nil
+	// for all of them.
+	scope map[string][]string
 }
 
-// githubRecord holds the data for the airtable fields that define the github data.
+// githubRecord holds the data for the fields that define the github data.
+// It is the record every Sink receives.
 type githubRecord struct {
 	ID     string `json:"id,omitempty"`
 	Fields Fields `json:"fields,omitempty"`
 }
 
-// Fields defines the airtable fields for the data.
+// fieldNames are the names of the fields we sync, in the order of the columns
+// in the table.
+var fieldNames = []string{
+	"Reference",
+	"Title",
+	"State",
+	"Author",
+	"Type",
+	"Labels",
+	"Assignees",
+	"Milestone",
+	"MilestoneDueDate",
+	"Comments",
+	"URL",
+	"Updated",
+	"Created",
+	"Completed",
+	"Project",
+	"Repository",
+}
+
+// optionalFields are only synced by the jobs that ask for them, since the
+// tables made before they were added do not have their columns.
+var optionalFields = []string{
+	"Assignees",
+	"Milestone",
+	"MilestoneDueDate",
+}
+
+// fieldColumns are the columns --fields syncs the optional fields to, for
+// the ones whose column is not named after them.
+var fieldColumns = map[string]string{
+	"MilestoneDueDate": "Milestone Due Date",
+}
+
+// Fields defines the fields for the data.
 type Fields struct {
-	Reference  string
-	Title      string
-	State      string
-	Author     string
-	Type       string
-	Labels     []string
-	Comments   int
-	URL        string
-	Updated    time.Time
-	Created    time.Time
-	Completed  time.Time
-	Project    interface{}
+	Reference string
+	Title     string
+	State     string
+	Author    string
+	Type      string
+	Labels    []string
+	// Assignees are the logins of the users the issue is assigned to.
+	Assignees []string
+	// Milestone is the title of the issue's milestone, and MilestoneDueDate
+	// when it is due. Both are empty if the issue has no milestone.
+	Milestone        string
+	MilestoneDueDate time.Time
+	Comments         int
+	URL              string
+	Updated          time.Time
+	Created          time.Time
+	Completed        time.Time
+	// Project holds the names of the projects the issue belongs to, the
+	// sink links them to the records in the projects table.
+	Project    []string
 	Repository string
+
+	// Computed holds the values of the computed columns, keyed by column.
+	Computed map[string]string
+	// Other holds the values of other columns to copy to the archive table,
+	// keyed by column.
+	Other map[string]interface{}
 }
 
-func (bot *bot) run(ctx context.Context, affiliation string) error {
-	// if we are in autofill mode, get our repositories
-	if autofill {
-		page := 1
-		perPage := 100
-		logrus.Infof("getting repositories to be autofilled for org[s]: %s...", strings.Join(orgs, ", "))
-		if err := bot.getRepositories(ctx, page, perPage, affiliation); err != nil {
-			logrus.Errorf("Failed to get repos, %v\n", err)
-			return err
+// loop runs the bot every interval for its job, until the context is done.
+func (bot *bot) loop(ctx context.Context) {
+	ticker := time.NewTicker(bot.job.Interval)
+	defer ticker.Stop()
+
+	bot.log.Infof("Starting bot to update airtable table %s for base %s every %s", bot.job.Airtable.Table, bot.job.Airtable.BaseID, bot.job.Interval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Keep going, so one failed run does not stop the other jobs.
+			if err := bot.run(ctx); err != nil {
+				bot.log.Errorf("Syncing the table failed: %v", err)
+			}
 		}
 	}
+}
 
-	ghRecords := []githubRecord{}
-	if err := bot.airtableClient.ListRecords(airtableTableName, &ghRecords); err != nil {
-		return fmt.Errorf("listing records for table %s failed: %v", airtableTableName, err)
-	}
-
-	since, err := time.Parse("2006-01-02T15:04:05Z", watchSince)
+func (bot *bot) run(ctx context.Context) error {
+	w, err := bot.diff(ctx)
 	if err != nil {
 		return err
 	}
 
-	for _, record := range ghRecords {
-		if record.Fields.Updated.After(since) {
-			since = record.Fields.Updated
+	ok, unwritten := bot.write(ctx, w)
+	bot.log.Infof("Synced records: %d created, %d updated, %d unchanged, %d archived, %d deleted", len(w.creates), len(w.updates), w.unchanged, len(w.archives), len(w.destroys))
+	bot.track(w)
+
+	// Hold back the cursors of the repositories with issues that did not make
+	// it into the sink, otherwise the next run would skip them. The records we
+	// failed to refresh are fetched again every run, whatever the cursors.
+	for _, reference := range unwritten {
+		ref, err := parseReference(reference)
+		if err != nil {
+			continue
+		}
+		delete(bot.cursors, ref.repository().String())
+	}
+	bot.state.setCursors(bot.table, bot.cursors)
+	if err := bot.state.save(); err != nil {
+		bot.log.Warnf("saving sync state to %s failed: %v", bot.state.path, err)
+	}
+
+	if !ok {
+		return fmt.Errorf("writing records to airtable table %s failed", bot.job.Airtable.Table)
+	}
+	return w.failed.errorOrNil()
+}
+
+// diff fetches the issues and the records in the sink, and works out the
+// writes needed to bring the sink up to date, without making them.
+func (bot *bot) diff(ctx context.Context) (writes, error) {
+	// Reset the cursors we advance in this run, and the repositories in
+	// scope.
+	bot.cursors = map[string]time.Time{}
+	bot.scope = map[string][]string{}
+
+	// if we are in autofill mode, get our repositories
+	if bot.job.Autofill {
+		for _, src := range bot.autofill {
+			repos, err := src.Repositories(ctx)
+			if err != nil {
+				bot.log.Errorf("Failed to get repos, %v\n", err)
+				return writes{}, err
+			}
+
+			// Only keep the issues of the team members, if we were asked to.
+			var members []string
+			if t, ok := src.(teamer); ok && bot.job.TeamMembersOnly {
+				members, err = t.TeamMembers(ctx)
+				if err != nil {
+					return writes{}, err
+				}
+			}
+
+			for _, repo := range repos {
+				if !bot.job.Filters.Repositories.match(repo) {
+					bot.log.Debugf("Skipping repo %s, it does not match the repository filters", repo)
+					continue
+				}
+				if err := bot.getItems(ctx, src, repo, members); err != nil {
+					bot.log.Debugf("Failed to get issues for repo %s - %v\n", repo.Name, err)
+					return writes{}, err
+				}
+			}
 		}
 	}
 
+	ghRecords, err := bot.sink.ListRecords(ctx)
+	if err != nil {
+		return writes{}, err
+	}
+
 	// if we are in watching mode, get your watched repositories
-	if watched {
-		page := 1
-		perPage := 100
-		logrus.Info("getting repositories watched...")
+	if bot.job.Watched {
+		for _, src := range bot.sources {
+			w, ok := src.(watcher)
+			if !ok {
+				continue
+			}
+			repos, err := w.WatchedRepositories(ctx)
+			if err != nil {
+				return writes{}, err
+			}
+			for _, repo := range repos {
+				if err := bot.getItems(ctx, src, repo, nil); err != nil {
+					return writes{}, err
+				}
+			}
+		}
+	}
 
-		if err := bot.getWatchedRepositories(ctx, page, perPage, since); err != nil {
-			return err
+	// if we are in starred mode, get the starred repositories
+	if bot.job.Starred {
+		for _, src := range bot.sources {
+			s, ok := src.(starrer)
+			if !ok {
+				continue
+			}
+			repos, err := s.StarredRepositories(ctx, bot.job.StarredUser)
+			if err != nil {
+				return writes{}, err
+			}
+			for _, repo := range repos {
+				if err := bot.getItems(ctx, src, repo, nil); err != nil {
+					return writes{}, err
+				}
+			}
+		}
+	}
+
+	// if we are in my work mode, get the issues the user is involved in
+	if bot.job.MyWork {
+		for _, src := range bot.sources {
+			inbox, ok := src.(inboxer)
+			if !ok {
+				continue
+			}
+			items, err := inbox.Inbox(ctx)
+			if err != nil {
+				return writes{}, err
+			}
+			for _, i := range items {
+				bot.issues[i.ref.String()] = i
+			}
 		}
 	}
 
-	// Iterate over the records.
+	// Get the issues for the repositories the job lists.
+	for _, name := range bot.job.Repos {
+		repo, err := parseRepository(name)
+		if err != nil {
+			return writes{}, err
+		}
+		src := bot.source(repo.Host)
+		if src == nil {
+			bot.log.Infof("No source configured for repository %s", name)
+			continue
+		}
+		if err := bot.getItems(ctx, src, repo, nil); err != nil {
+			return writes{}, err
+		}
+	}
+
+	// Get the issues matching the search query.
+	if len(bot.job.Search) > 0 {
+		for _, src := range bot.sources {
+			s, ok := src.(searcher)
+			if !ok {
+				continue
+			}
+			items, err := s.Search(ctx, bot.job.Search)
+			if err != nil {
+				return writes{}, err
+			}
+			for _, i := range items {
+				bot.issues[i.ref.String()] = i
+			}
+		}
+	}
+
+	// Match the records to their sources, and to the issues we already
+	// have from autofill or watched, before we fan out.
+	type refresh struct {
+		record githubRecord
+		ref    reference
+		src    Source
+		issue  *item
+	}
+	refreshes := []refresh{}
 	for _, record := range ghRecords {
 		// Parse the reference.
-		user, repo, id, err := parseReference(record.Fields.Reference)
+		ref, err := parseReference(record.Fields.Reference)
 		if err != nil {
-			logrus.Infof("Reference for %v failed:\n%v\n", record, err)
+			bot.log.Infof("Reference for %v failed:\n%v\n", record, err)
+			continue
+		}
+		key := ref.String()
+
+		src := bot.source(ref.Host)
+		if src == nil {
+			bot.log.Infof("No source configured for reference %s", record.Fields.Reference)
 			continue
 		}
 
-		// Get the github issue.
-		var issue *github.Issue
+		r := refresh{record: record, ref: ref, src: src}
 
 		// Check if we already have it from autofill or watched.
-		if autofill || watched {
-			if i, ok := bot.issues[record.Fields.Reference]; ok {
-				logrus.Debugf("found github issue %s from autofill", record.Fields.Reference)
-				issue = i
+		if bot.job.Autofill || bot.job.Watched || bot.job.Starred || bot.job.MyWork || len(bot.job.Repos) > 0 || len(bot.job.Search) > 0 {
+			if i, ok := bot.issues[key]; ok {
+				bot.log.Debugf("found issue %s from autofill", key)
+				r.issue = i
 				// delete the key from the autofilled map
-				delete(bot.issues, record.Fields.Reference)
+				delete(bot.issues, key)
 			}
 		}
 
+		refreshes = append(refreshes, r)
+	}
+
+	// Fetch the issues we are missing in batches, from the sources that can.
+	for _, src := range bot.sources {
+		b, ok := src.(batcher)
+		if !ok {
+			continue
+		}
+		refs := []reference{}
+		for _, r := range refreshes {
+			if r.src == src && r.issue == nil {
+				refs = append(refs, r.ref)
+			}
+		}
+		if len(refs) == 0 {
+			continue
+		}
+		items, err := b.BatchItems(ctx, refs)
+		if err != nil {
+			return writes{}, err
+		}
+		for n, r := range refreshes {
+			if r.src != src || r.issue != nil {
+				continue
+			}
+			if i, ok := items[r.ref.String()]; ok {
+				refreshes[n].issue = i
+			}
+		}
+	}
+
+	// Refresh the records.
+	updates := make([]*githubRecord, len(refreshes))
+	destroys := make([]*githubRecord, len(refreshes))
+	errs := forEach(ctx, len(refreshes), concurrency, func(n int) error {
+		r := refreshes[n]
+
 		// If we don't already have the issue, then get it.
-		if issue == nil {
-			logrus.Debugf("getting issue %s", record.Fields.Reference)
-			issue, _, err = bot.ghClient.Issues.Get(ctx, user, repo, id)
+		i := r.issue
+		if i == nil {
+			var err error
+			i, err = r.src.Item(ctx, r.ref)
 			if err != nil {
-				if strings.Contains(err.Error(), "404 Not Found") {
-					// Delete it from the table, the repo has probably moved or something.
-					if err := bot.airtableClient.DestroyRecord(airtableTableName, record.ID); err != nil {
-						logrus.Warnf("destroying record %s failed: %v", record.ID, err)
+				if err == errNotFound {
+					// The issue no longer exists, mark or delete its record
+					// depending on the retention policy.
+					if bot.job.Retention.Gone == retentionMark {
+						record := bot.job.Retention.markGone(r.record)
+						updates[n] = &record
+						return nil
 					}
-					continue
+					destroys[n] = &refreshes[n].record
+					return nil
 				}
-				return fmt.Errorf("getting issue %s failed: %v", record.Fields.Reference, err)
+				return fmt.Errorf("getting issue failed: %v", err)
 			}
 		}
 
-		if err := bot.applyRecordToTable(ctx, issue, record.Fields.Reference, record.ID); err != nil {
-			return err
+		if bot.job.Filters.Prune && !bot.job.Filters.match(i) {
+			bot.log.Debugf("pruning record %s for issue %s that no longer matches the filters", r.record.ID, r.record.Fields.Reference)
+			destroys[n] = &refreshes[n].record
+			return nil
 		}
-	}
 
-	// If we autofilled issues, loop over and create which ever ones remain.
-	for key, issue := range bot.issues {
-		if err := bot.applyRecordToTable(ctx, issue, key, ""); err != nil {
-			logrus.Errorf("Failed to apply record to table for reference %s because %v\n", key, err)
-			continue
-		}
+		record := bot.newRecord(i, r.record.ID)
+		updates[n] = &record
+		return nil
+	})
+	w := writes{}
+	for n, err := range errs {
+		w.failed.add(refreshes[n].record.Fields.Reference, err)
 	}
 
-	return nil
-}
-
-func (bot *bot) applyRecordToTable(ctx context.Context, issue *github.Issue, key, id string) error {
-	// Trim surrounding quotes from ID string.
-	id = strings.Trim(id, "\"")
-
-	// Parse the reference.
-	user, repo, number, err := parseReference(key)
-	if err != nil {
-		return err
+	references := map[string]bool{}
+	for _, record := range ghRecords {
+		references[record.Fields.Reference] = true
 	}
+	for n, r := range refreshes {
+		if updates[n] != nil && updates[n].Fields.Reference != r.record.Fields.Reference {
+			// The issue was transferred or its repository renamed, move the
+			// record along unless the table already has one for where it is
+			// now.
+			moved := updates[n].Fields.Reference
+			if references[moved] {
+				bot.log.Infof("Record %s for issue %s is a duplicate of the one for %s, where it moved", r.record.ID, r.record.Fields.Reference, moved)
+				updates[n], destroys[n] = nil, &refreshes[n].record
+			} else {
+				bot.log.Infof("Moving record %s for issue %s to %s", r.record.ID, r.record.Fields.Reference, moved)
+				references[moved] = true
+			}
+			// Do not create it again if we also got it from where it is now.
+			delete(bot.issues, moved)
+		}
 
-	// Iterate over the labels.
-	labels := []string{}
-	for _, label := range issue.Labels {
-		labels = append(labels, label.GetName())
-	}
+		if updates[n] != nil && bot.job.Retention.expired(updates[n].Fields) {
+			// The issue has been closed long enough, archive or delete it.
+			if bot.job.Retention.Closed == retentionArchive {
+				record := *updates[n]
+				record.Fields.Other = r.record.Fields.Other
+				w.archives = append(w.archives, record)
+			} else {
+				w.destroys = append(w.destroys, r.record)
+			}
+			continue
+		}
 
-	issueType := "issue"
-	if issue.IsPullRequest() {
-		issueType = "pull request"
-		// If the status is closed, we should find out if the
-		// _actual_ pull request status is "merged".
-		merged, _, err := bot.ghClient.PullRequests.IsMerged(ctx, user, repo, number)
-		if err != nil {
-			return err
+		if updates[n] != nil {
+			// Only send the update if something actually changed.
+			if changed := changedFields(r.record.Fields, updates[n].Fields); len(changed) > 0 {
+				bot.log.Debugf("record %s for issue %s changed: %s", r.record.ID, r.record.Fields.Reference, strings.Join(changed, ", "))
+				w.updates = append(w.updates, *updates[n])
+				w.existing = append(w.existing, r.record)
+			} else {
+				w.unchanged++
+			}
 		}
-		if merged {
-			mstr := "merged"
-			issue.State = &mstr
-		}
-	}
-
-	// Create our empty record struct.
-	record := githubRecord{
-		ID: id,
-		Fields: Fields{
-			Reference:  key,
-			Title:      issue.GetTitle(),
-			State:      issue.GetState(),
-			Author:     issue.GetUser().GetLogin(),
-			Type:       issueType,
-			Comments:   issue.GetComments(),
-			URL:        issue.GetHTMLURL(),
-			Updated:    issue.GetUpdatedAt(),
-			Created:    issue.GetCreatedAt(),
-			Completed:  issue.GetClosedAt(),
-			Repository: repo,
-		},
-	}
-
-	// Update the record fields.
-	fields := map[string]interface{}{
-		"Reference":  record.Fields.Reference,
-		"Title":      record.Fields.Title,
-		"State":      record.Fields.State,
-		"Author":     record.Fields.Author,
-		"Type":       record.Fields.Type,
-		"Comments":   record.Fields.Comments,
-		"URL":        record.Fields.URL,
-		"Updated":    record.Fields.Updated,
-		"Created":    record.Fields.Created,
-		"Completed":  record.Fields.Completed,
-		"Repository": record.Fields.Repository,
-	}
-
-	if id != "" {
-		// If we were passed a record ID, update the record instead of create.
-		logrus.Debugf("updating record %s for issue %s", id, key)
-		if err := bot.airtableClient.UpdateRecord(airtableTableName, id, fields, &record); err != nil {
-			logrus.Warnf("updating record %s for issue %s failed: %v", id, key, err)
-			return nil
+		if destroys[n] != nil {
+			w.destroys = append(w.destroys, *destroys[n])
 		}
-	} else {
-		// Create the field.
-		logrus.Debugf("creating new record for issue %s", key)
-		if err := bot.airtableClient.CreateRecord(airtableTableName, &record); err != nil {
-			return err
+	}
+
+	// If we autofilled issues, create which ever ones remain and match the
+	// filters.
+	keys := []string{}
+	for key, i := range bot.issues {
+		if bot.job.Filters.match(i) && !bot.job.Retention.expired(i.fields) {
+			keys = append(keys, key)
 		}
 	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		w.creates = append(w.creates, bot.newRecord(bot.issues[key], ""))
+	}
 
-	// Try again with labels, since the user may not have pre-populated the label options.
-	// TODO: add a create multiple select when the airtable API supports it.
-	fields["Labels"] = labels
-	if err := bot.airtableClient.UpdateRecord(airtableTableName, record.ID, fields, &record); err != nil {
-		logrus.Warnf("updating record with labels %s for issue %s failed: %v", record.ID, key, err)
+	bot.records = map[string]githubRecord{}
+	for _, record := range ghRecords {
+		bot.records[record.Fields.Reference] = record
 	}
 
+	return w, nil
+}
+
+// source returns the source for the reference host.
+func (bot *bot) source(host string) Source {
+	for _, src := range bot.sources {
+		if src.Host() == host {
+			return src
+		}
+	}
 	return nil
 }
 
-func (bot *bot) getRepositories(ctx context.Context, page, perPage int, affiliation string) error {
-	opt := &github.RepositoryListOptions{
-		Affiliation: affiliation,
-		ListOptions: github.ListOptions{
-			Page:    page,
-			PerPage: perPage,
-		},
+// getItems adds the issues and pull requests for a repository to the
+// autofilled map, fetching only what changed since the repository's cursor.
+// If members is not nil, only the issues authored by or assigned to them are
+// added.
+func (bot *bot) getItems(ctx context.Context, src Source, repo repository, members []string) error {
+	since, ok := bot.state.cursor(bot.table, repo.String())
+	if !ok {
+		var err error
+		since, err = time.Parse("2006-01-02T15:04:05Z", watchSince)
+		if err != nil {
+			return err
+		}
 	}
-	repos, resp, err := bot.ghClient.Repositories.List(ctx, "", opt)
+
+	start := time.Now()
+	items, err := src.Items(ctx, repo, since)
 	if err != nil {
 		return err
 	}
 
-	for _, repo := range repos {
-		// logrus.Debugf("checking if %s is in (%s)", repo.GetOwner().GetLogin(), strings.Join(orgs, " | "))
-		if in(orgs, repo.GetOwner().GetLogin()) {
-			logrus.Debugf("getting issues for repo %s...", repo.GetFullName())
-			ipage := 0
-			if err := bot.getIssues(ctx, ipage, perPage, repo.GetOwner().GetLogin(), repo.GetName(), repo.UpdatedAt.Time); err != nil {
-				logrus.Debugf("Failed to get issues for repo %s - %v\n", repo.GetName(), err)
-				return err
-			}
+	for _, i := range items {
+		if members != nil && !i.ownedBy(members) {
+			continue
 		}
+		bot.issues[i.ref.String()] = i
 	}
+	bot.cursors[repo.String()] = start
 
-	// Return early if we are on the last page.
-	if page == resp.LastPage || resp.NextPage == 0 {
-		return nil
+	// A repository fetched for everyone stays that way.
+	if m, ok := bot.scope[repo.String()]; !ok || m != nil {
+		bot.scope[repo.String()] = members
 	}
+	return nil
+}
 
-	page = resp.NextPage
-	return bot.getRepositories(ctx, page, perPage, affiliation)
+// inScope reports whether the issue is in one of the repositories the last
+// run fetched the issues of, and authored by or assigned to the users the
+// repository was fetched for, if any.
+func (bot *bot) inScope(i *item) bool {
+	members, ok := bot.scope[i.ref.repository().String()]
+	return ok && (members == nil || i.ownedBy(members))
 }
 
-func (bot *bot) getWatchedRepositories(ctx context.Context, page, perPage int, since time.Time) error {
-	opt := &github.ListOptions{
-		Page:    page,
-		PerPage: perPage,
+// writes holds the records to write to the sink in a run.
+type writes struct {
+	creates  []githubRecord
+	updates  []githubRecord
+	destroys []githubRecord
+	// archives holds the records to move to the archive table.
+	archives []githubRecord
+
+	// existing holds the records as they are in the sink, in the same order
+	// as updates.
+	existing []githubRecord
+
+	// unchanged is the number of records we skipped since they were already
+	// up to date.
+	unchanged int
+
+	// failed holds the references we could not refresh.
+	failed syncErrors
+}
+
+// track applies the writes to the records we keep in between runs.
+func (bot *bot) track(w writes) {
+	if bot.records == nil {
+		bot.records = map[string]githubRecord{}
+	}
+	for _, records := range [][]githubRecord{w.updates, w.creates} {
+		for _, record := range records {
+			// Creates that failed have no ID.
+			if record.ID != "" {
+				bot.records[record.Fields.Reference] = record
+			}
+		}
+	}
+	for _, records := range [][]githubRecord{w.destroys, w.archives} {
+		for _, record := range records {
+			delete(bot.records, record.Fields.Reference)
+		}
+	}
+	// Drop the old references of the records that moved.
+	for n, record := range w.existing {
+		if n < len(w.updates) && w.updates[n].ID != "" && record.Fields.Reference != w.updates[n].Fields.Reference {
+			delete(bot.records, record.Fields.Reference)
+		}
 	}
+}
 
-	repos, resp, err := bot.ghClient.Activity.ListWatched(ctx, "", opt)
-	if err != nil {
-		return err
+// write sends the writes to the sink in batches. Failures are logged rather
+// than returned, so one bad row does not stop the rest of the table from
+// being synced, write only reports whether everything was written and the
+// references of the records that failed to be created or updated.
+func (bot *bot) write(ctx context.Context, w writes) (bool, []string) {
+	ok := true
+	unwritten := []string{}
+
+	if len(w.archives) > 0 {
+		bot.log.Debugf("archiving %d records", len(w.archives))
+		if !bot.moveToArchive(ctx, w.archives) {
+			ok = false
+		}
 	}
 
-	for _, repo := range repos {
-		// logrus.Debugf("checking if %s is in (%s)", repo.GetOwner().GetLogin(), strings.Join(orgs, " | "))
-		// logrus.Debugf("getting issues for repo %s...", repo.GetFullName())
-		ipage := 0
-		if err := bot.getIssues(ctx, ipage, perPage, repo.GetOwner().GetLogin(), repo.GetName(), since); err != nil {
-			return err
+	if len(w.destroys) > 0 {
+		bot.log.Debugf("destroying %d records", len(w.destroys))
+		if err := bot.sink.DestroyRecords(ctx, w.destroys); err != nil {
+			bot.log.Warnf("destroying records failed: %v", err)
+			ok = false
 		}
 	}
 
-	// Return early if we are on the last page.
-	if page == resp.LastPage || resp.NextPage == 0 {
-		return nil
+	if len(w.updates) > 0 {
+		bot.log.Debugf("updating %d records", len(w.updates))
+		if err := bot.sink.UpdateRecords(ctx, w.updates); err != nil {
+			bot.log.Warnf("updating records failed: %v", err)
+			ok = false
+			unwritten = append(unwritten, failedReferences(w.updates, err)...)
+		}
 	}
 
-	page = resp.NextPage
-	return bot.getWatchedRepositories(ctx, page, perPage, since)
+	if len(w.creates) > 0 {
+		bot.log.Debugf("creating %d new records", len(w.creates))
+		if err := bot.sink.CreateRecords(ctx, w.creates); err != nil {
+			bot.log.Errorf("Failed to apply records to table because %v\n", err)
+			ok = false
+			unwritten = append(unwritten, failedReferences(w.creates, err)...)
+		}
+	}
+
+	return ok, unwritten
 }
 
-func (bot *bot) getIssues(ctx context.Context, page, perPage int, owner, repo string, since time.Time) error {
-	opt := &github.IssueListByRepoOptions{
-		State: "all",
-		Since: since,
-		ListOptions: github.ListOptions{
-			Page:    page,
-			PerPage: perPage,
-		},
+// failedReferences returns the references of the records a write to the sink
+// failed for, which is all of them unless the error says which.
+func failedReferences(records []githubRecord, err error) []string {
+	refs := []string{}
+	if e, ok := err.(syncErrors); ok {
+		for _, s := range e {
+			refs = append(refs, s.reference)
+		}
+		return refs
 	}
-
-	issues, resp, err := bot.ghClient.Issues.ListByRepo(ctx, owner, repo, opt)
-	if err != nil {
-		return err
+	for _, record := range records {
+		refs = append(refs, record.Fields.Reference)
 	}
+	return refs
+}
 
-	for _, issue := range issues {
-		key := fmt.Sprintf("%s/%s#%d", owner, repo, issue.GetNumber())
+// moveToArchive creates the records in the archive table, then deletes the
+// ones that made it there from the table.
+func (bot *bot) moveToArchive(ctx context.Context, records []githubRecord) bool {
+	ok := true
 
-		// logrus.Debugf("handling issue %s...", key)
-		bot.issues[key] = issue
+	copies := make([]githubRecord, len(records))
+	for n, record := range records {
+		copies[n] = record
+		copies[n].ID = ""
+	}
+	if err := bot.archive.CreateRecords(ctx, copies); err != nil {
+		bot.log.Warnf("archiving records failed: %v", err)
+		ok = false
 	}
 
-	// Return early if we are on the last page.
-	if page == resp.LastPage || resp.NextPage == 0 {
-		return nil
+	archived := []githubRecord{}
+	for n, record := range records {
+		if copies[n].ID != "" {
+			archived = append(archived, record)
+		}
+	}
+	if len(archived) > 0 {
+		if err := bot.sink.DestroyRecords(ctx, archived); err != nil {
+			bot.log.Warnf("deleting archived records failed: %v", err)
+			ok = false
+		}
 	}
 
-	page = resp.NextPage
-	return bot.getIssues(ctx, page, perPage, owner, repo, since)
+	return ok
 }
 
-func parseReference(ref string) (string, string, int, error) {
-	// Split the reference into repository and issue number.
-	parts := strings.SplitN(ref, "#", 2)
-	if len(parts) < 2 {
-		return "", "", 0, fmt.Errorf("could not parse reference name into repository and issue number for %s, got: %#v", ref, parts)
+// newRecord creates the record for the issue, with the ID of the existing
+// record if we are updating one.
+func newRecord(i *item, id string) githubRecord {
+	return githubRecord{
+		// Trim surrounding quotes from ID string.
+		ID:     strings.Trim(id, "\""),
+		Fields: i.fields,
 	}
-	repolong := parts[0]
-	i := parts[1]
+}
 
-	// Parse the string id into an int.
-	id, err := strconv.Atoi(i)
-	if err != nil {
-		return "", "", 0, err
+// newRecord creates the record for the issue, leaving out the fields the job
+// does not sync so they never show up as changed, and computing the values of
+// the computed columns.
+func (bot *bot) newRecord(i *item, id string) githubRecord {
+	record := newRecord(i, id)
+
+	columns := bot.job.columns()
+	fields := reflect.ValueOf(&record.Fields).Elem()
+	for _, name := range fieldNames {
+		if _, ok := columns[name]; !ok {
+			field := fields.FieldByName(name)
+			field.Set(reflect.Zero(field.Type()))
+		}
 	}
 
-	// Split the repo name into owner and repo.
-	parts = strings.SplitN(repolong, "/", 2)
-	if len(parts) < 2 {
-		return "", "", 0, fmt.Errorf("could not parse reference name into owner and repo for %s, got: %#v", repolong, parts)
+	// Projects missing from the projects table cannot be linked to, unless
+	// they are created, leave them out so they never show up as changed.
+	if bot.job.Projects.enabled() {
+		record.Fields.Project = bot.projects.known(bot.job.Projects.match(i))
 	}
 
-	return parts[0], parts[1], id, nil
+	// Assignees that are not airtable collaborators cannot be in the
+	// column, leave them out so they never show up as changed.
+	if len(bot.job.Collaborators) > 0 {
+		assignees := []string{}
+		for _, assignee := range record.Fields.Assignees {
+			if _, ok := bot.job.Collaborators[assignee]; ok {
+				assignees = append(assignees, assignee)
+			}
+		}
+		record.Fields.Assignees = assignees
+	}
+
+	if len(bot.computed) > 0 {
+		record.Fields.Computed = map[string]string{}
+		for _, c := range bot.computed {
+			v, err := c.compute(i)
+			if err != nil {
+				bot.log.Warnf("computing column %s for issue %s failed: %v", c.column, i.ref, err)
+			}
+			record.Fields.Computed[c.column] = v
+		}
+	}
+
+	return record
+}
+
+// stateTable returns the key for the table in the sync state.
+func stateTable(baseID, table string) string {
+	return baseID + "/" + table
 }
 
-func in(a stringSlice, s string) bool {
+func in(a []string, s string) bool {
 	for _, b := range a {
 		if b == s {
 			return true
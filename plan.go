@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const planHelp = `Show the records a sync would create, update and delete, and the fields it
+would change for each record, without writing anything to the table.
+
+All the reads are still made, so the plan is exactly what the next run would
+do. The sync cursors are not advanced. With --json, a JSON object is printed
+for every job.`
+
+type planCommand struct {
+	json bool
+}
+
+func (cmd *planCommand) Name() string      { return "plan" }
+func (cmd *planCommand) Args() string      { return "" }
+func (cmd *planCommand) ShortHelp() string { return "Show what a sync would change, without writing." }
+func (cmd *planCommand) LongHelp() string  { return planHelp }
+func (cmd *planCommand) Hidden() bool      { return false }
+
+func (cmd *planCommand) Register(fs *flag.FlagSet) {
+	fs.BoolVar(&cmd.json, "json", false, "print the plan as JSON")
+}
+
+func (cmd *planCommand) Run(ctx context.Context, args []string) error {
+	bots, err := newBots(ctx)
+	if err != nil {
+		return err
+	}
+
+	failed := syncErrors{}
+	for n, bot := range bots {
+		w, err := bot.diff(ctx)
+		if err != nil {
+			return err
+		}
+		failed = append(failed, w.failed...)
+
+		p := newPlan(w)
+		p.Job = bot.job.Name
+		if cmd.json {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(p); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if len(bots) > 1 {
+			if n > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("Job %s:\n\n", bot.job.Name)
+		}
+		p.print(os.Stdout)
+	}
+
+	return failed.errorOrNil()
+}
+
+// plan describes the writes a sync would make.
+type plan struct {
+	Job       string       `json:"job"`
+	Creates   []planRecord `json:"creates"`
+	Updates   []planRecord `json:"updates"`
+	Archives  []planRecord `json:"archives"`
+	Deletes   []planRecord `json:"deletes"`
+	Unchanged int          `json:"unchanged"`
+}
+
+// planRecord is a record in the plan.
+type planRecord struct {
+	ID        string       `json:"id,omitempty"`
+	Reference string       `json:"reference"`
+	Title     string       `json:"title"`
+	Changes   []planChange `json:"changes,omitempty"`
+}
+
+// planChange is a field that changes in an updated record.
+type planChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// newPlan creates the plan for the writes.
+func newPlan(w writes) plan {
+	p := plan{
+		Creates:   []planRecord{},
+		Updates:   []planRecord{},
+		Archives:  []planRecord{},
+		Deletes:   []planRecord{},
+		Unchanged: w.unchanged,
+	}
+
+	for _, record := range w.creates {
+		p.Creates = append(p.Creates, planRecord{
+			Reference: record.Fields.Reference,
+			Title:     record.Fields.Title,
+		})
+	}
+
+	for n, record := range w.updates {
+		r := planRecord{
+			ID:        record.ID,
+			Reference: record.Fields.Reference,
+			Title:     record.Fields.Title,
+		}
+		for _, field := range changedFields(w.existing[n].Fields, record.Fields) {
+			r.Changes = append(r.Changes, planChange{
+				Field: field,
+				From:  fieldValue(w.existing[n].Fields, field),
+				To:    fieldValue(record.Fields, field),
+			})
+		}
+		p.Updates = append(p.Updates, r)
+	}
+
+	for _, record := range w.archives {
+		p.Archives = append(p.Archives, planRecord{
+			ID:        record.ID,
+			Reference: record.Fields.Reference,
+			Title:     record.Fields.Title,
+		})
+	}
+
+	for _, record := range w.destroys {
+		p.Deletes = append(p.Deletes, planRecord{
+			ID:        record.ID,
+			Reference: record.Fields.Reference,
+			Title:     record.Fields.Title,
+		})
+	}
+
+	return p
+}
+
+// print writes the plan in a human readable format.
+func (p plan) print(w io.Writer) {
+	for _, r := range p.Creates {
+		fmt.Fprintf(w, "+ create %s: %s\n", r.Reference, r.Title)
+	}
+	for _, r := range p.Updates {
+		fmt.Fprintf(w, "~ update %s (%s): %s\n", r.Reference, r.ID, r.Title)
+		for _, c := range r.Changes {
+			fmt.Fprintf(w, "    %s: %s -> %s\n", c.Field, planValue(c.From), planValue(c.To))
+		}
+	}
+	for _, r := range p.Archives {
+		fmt.Fprintf(w, "> archive %s (%s): %s\n", r.Reference, r.ID, r.Title)
+	}
+	for _, r := range p.Deletes {
+		fmt.Fprintf(w, "- delete %s (%s): %s\n", r.Reference, r.ID, r.Title)
+	}
+
+	fmt.Fprintf(w, "\nPlan: %d to create, %d to update, %d to archive, %d to delete, %d unchanged.\n", len(p.Creates), len(p.Updates), len(p.Archives), len(p.Deletes), p.Unchanged)
+}
+
+// planValue formats a field value for the human readable plan.
+func planValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case []string:
+		return "[" + strings.Join(v, ", ") + "]"
+	case time.Time:
+		if v.IsZero() {
+			return "<none>"
+		}
+		return v.Format(time.RFC3339)
+	case nil:
+		return "<none>"
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// defaultProjectNameColumn is the column of the projects table projects are
+// looked up by.
+const defaultProjectNameColumn = "Name"
+
+// projectsConfig defines the rules that link the records to the projects
+// they belong to, which are records in another table of the base.
+type projectsConfig struct {
+	// Table is the projects table the Project column links to.
+	Table string `yaml:"table"`
+	// NameColumn is the column projects are looked up by, it defaults to
+	// Name.
+	NameColumn string `yaml:"name_column"`
+	// Create adds the projects missing from the projects table, instead of
+	// leaving them out.
+	Create bool `yaml:"create"`
+	// Rules are matched against every issue, it belongs to the projects of
+	// all the rules it matches.
+	Rules []projectRule `yaml:"rules"`
+}
+
+// projectRule links the issues matching it to a project. Empty lists match
+// everything, but a rule has to have at least one of them.
+type projectRule struct {
+	Project string `yaml:"project"`
+	// Repos, Labels and Milestones are patterns, either globs or regular
+	// expressions between slashes, for the {owner}/{repo} name of the
+	// repository, the labels and the milestone. Any of the values has to
+	// match one of the patterns.
+	Repos      []string `yaml:"repos"`
+	Labels     []string `yaml:"labels"`
+	Milestones []string `yaml:"milestones"`
+}
+
+// enabled reports whether the job links records to projects.
+func (p projectsConfig) enabled() bool {
+	return len(p.Table) > 0
+}
+
+// nameColumn returns the column projects are looked up by.
+func (p projectsConfig) nameColumn() string {
+	if len(p.NameColumn) < 1 {
+		return defaultProjectNameColumn
+	}
+	return p.NameColumn
+}
+
+// validate checks the project rules make sense.
+func (p projectsConfig) validate(job jobConfig) error {
+	if !p.enabled() {
+		if len(p.Rules) > 0 {
+			return errors.New("projects table cannot be empty when there are project rules")
+		}
+		return nil
+	}
+
+	if p.Table == job.Airtable.Table {
+		return errors.New("projects table cannot be the table of the job")
+	}
+
+	for n, rule := range p.Rules {
+		if len(rule.Project) < 1 {
+			return fmt.Errorf("project rule %d has no project", n+1)
+		}
+		if len(rule.Repos) == 0 && len(rule.Labels) == 0 && len(rule.Milestones) == 0 {
+			return fmt.Errorf("project rule for %s has nothing to match", rule.Project)
+		}
+		for _, patterns := range [][]string{rule.Repos, rule.Labels, rule.Milestones} {
+			for _, pattern := range patterns {
+				if _, err := matchPattern(pattern, ""); err != nil {
+					return fmt.Errorf("invalid pattern %s in project rule for %s: %v", pattern, rule.Project, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// match returns the projects the issue belongs to, in the order of the
+// rules.
+func (p projectsConfig) match(i *item) []string {
+	projects := []string{}
+	for _, rule := range p.Rules {
+		if rule.match(i) && !in(projects, rule.Project) {
+			projects = append(projects, rule.Project)
+		}
+	}
+	return projects
+}
+
+// match reports whether the issue matches the rule.
+func (r projectRule) match(i *item) bool {
+	repo := repository{Owner: i.ref.Owner, Name: i.ref.Repo}
+	if len(r.Repos) > 0 && !matchAny(r.Repos, []string{repo.FullName()}) {
+		return false
+	}
+	if len(r.Labels) > 0 && !matchAny(r.Labels, i.fields.Labels) {
+		return false
+	}
+	if len(r.Milestones) > 0 && (len(i.fields.Milestone) < 1 || !matchAny(r.Milestones, []string{i.fields.Milestone})) {
+		return false
+	}
+	return true
+}
+
+// matchAny reports whether any of the values matches one of the patterns.
+func matchAny(patterns, values []string) bool {
+	for _, v := range values {
+		for _, pattern := range patterns {
+			if ok, _ := matchPattern(pattern, v); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+const resetHelp = `Reset the sync cursors for the table, so the next run fetches everything
+again. Pass repositories in the format [{host}:]{owner}/{repo} to only reset
+those, otherwise all the cursors for the table are reset.
+
+With a config file holding more than one job, pass --job to pick the table.`
+
+type resetCommand struct {
+	job string
+}
+
+func (cmd *resetCommand) Name() string      { return "reset" }
+func (cmd *resetCommand) Args() string      { return "[REPOSITORY...]" }
+func (cmd *resetCommand) ShortHelp() string { return "Reset the sync cursors for the table." }
+func (cmd *resetCommand) LongHelp() string  { return resetHelp }
+func (cmd *resetCommand) Hidden() bool      { return false }
+
+func (cmd *resetCommand) Register(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.job, "job", "", "name of the job from the config file whose table to reset")
+}
+
+func (cmd *resetCommand) Run(ctx context.Context, args []string) error {
+	state, err := loadState(stateFile)
+	if err != nil {
+		return err
+	}
+
+	job, err := cmd.findJob()
+	if err != nil {
+		return err
+	}
+	table := stateTable(job.Airtable.BaseID, job.Airtable.Table)
+
+	state.reset(table, args)
+	if err := state.save(); err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		logrus.Infof("Reset all cursors for table %s", table)
+		return nil
+	}
+	for _, repo := range args {
+		logrus.Infof("Reset cursor for %s in table %s", repo, table)
+	}
+	return nil
+}
+
+// findJob returns the job whose table to reset.
+func (cmd *resetCommand) findJob() (jobConfig, error) {
+	if len(cmd.job) < 1 {
+		if len(jobs) > 1 {
+			return jobConfig{}, errors.New("job cannot be empty when there is more than one job")
+		}
+		return jobs[0], nil
+	}
+
+	for _, job := range jobs {
+		if job.Name == cmd.job {
+			return job, nil
+		}
+	}
+	return jobConfig{}, fmt.Errorf("no job named %s", cmd.job)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// retentionDelete deletes the records.
+	retentionDelete = "delete"
+	// retentionMark keeps the records for issues that are gone, with their
+	// state set to say so.
+	retentionMark = "mark"
+	// retentionArchive moves the records to the archive table.
+	retentionArchive = "archive"
+
+	// defaultGoneState is the state records for issues that are gone are
+	// marked with.
+	defaultGoneState = "deleted upstream"
+)
+
+// retentionConfig defines what happens to the records for issues that are
+// gone, and for issues that have been closed for a while.
+type retentionConfig struct {
+	// Gone is what to do with the records for issues that no longer exist,
+	// delete or mark. It defaults to delete.
+	Gone string `yaml:"gone"`
+	// GoneState is the state records are marked with, it defaults to
+	// "deleted upstream".
+	GoneState string `yaml:"gone_state"`
+
+	// Closed is what to do with the records for issues closed longer than
+	// ClosedAfter ago, archive or delete. They are kept if it is empty.
+	Closed      string        `yaml:"closed"`
+	ClosedAfter time.Duration `yaml:"closed_after"`
+	// ArchiveTable is the table in the same base records are archived to,
+	// it needs the same columns as the table.
+	ArchiveTable string `yaml:"archive_table"`
+	// ArchiveColumns are other columns of the table to copy to the archive
+	// table, like the notes added by hand.
+	ArchiveColumns []string `yaml:"archive_columns"`
+}
+
+// validate checks the retention policy makes sense for the job.
+func (r retentionConfig) validate(job jobConfig) error {
+	switch r.Gone {
+	case "", retentionDelete:
+	case retentionMark:
+		if _, ok := job.columns()["State"]; !ok {
+			return errors.New("retention gone mark needs the State field to be synced")
+		}
+	default:
+		return fmt.Errorf("unknown retention gone %s, expected %s or %s", r.Gone, retentionDelete, retentionMark)
+	}
+
+	switch r.Closed {
+	case "":
+		return nil
+	case retentionDelete:
+	case retentionArchive:
+		if len(r.ArchiveTable) < 1 {
+			return errors.New("retention archive_table cannot be empty to archive closed records")
+		}
+		if r.ArchiveTable == job.Airtable.Table {
+			return errors.New("retention archive_table cannot be the table of the job")
+		}
+	default:
+		return fmt.Errorf("unknown retention closed %s, expected %s or %s", r.Closed, retentionArchive, retentionDelete)
+	}
+
+	if r.ClosedAfter <= 0 {
+		return errors.New("retention closed_after has to be positive")
+	}
+	if _, ok := job.columns()["Completed"]; !ok {
+		return errors.New("retention closed needs the Completed field to be synced")
+	}
+
+	columns := map[string]bool{}
+	for _, column := range job.columns() {
+		columns[column] = true
+	}
+	for column := range job.Computed {
+		columns[column] = true
+	}
+	for _, column := range r.ArchiveColumns {
+		if len(column) < 1 {
+			return errors.New("retention archive_columns cannot have an empty column")
+		}
+		if columns[column] {
+			return fmt.Errorf("retention archive column %s is already synced", column)
+		}
+	}
+
+	return nil
+}
+
+// markGone returns the record marked as being for an issue that is gone.
+func (r retentionConfig) markGone(record githubRecord) githubRecord {
+	record.Fields.State = r.GoneState
+	if len(record.Fields.State) < 1 {
+		record.Fields.State = defaultGoneState
+	}
+	// Only write back what we manage.
+	record.Fields.Other = nil
+	return record
+}
+
+// expired reports whether the record is for an issue closed long enough ago
+// to be archived or deleted.
+func (r retentionConfig) expired(f Fields) bool {
+	if len(r.Closed) < 1 || f.Completed.IsZero() {
+		return false
+	}
+	return time.Since(f.Completed) > r.ClosedAfter
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/sirupsen/logrus"
+)
+
+const serveHelp = `Listen for GitHub webhook deliveries and update the records for the issues
+and pull requests they are about right away. The whole table is still synced
+every --interval, to catch anything the webhooks missed.
+
+Configure the webhook to send the "issues", "pull_request", "issue_comment"
+and "label" events as application/json, with the same secret passed to
+--webhook-secret. New issues are only added to the table when --autofill or
+--watched is set.`
+
+// maxPayloadSize is the largest webhook payload GitHub delivers.
+const maxPayloadSize = 25 << 20
+
+type serveCommand struct {
+	addr   string
+	secret string
+}
+
+func (cmd *serveCommand) Name() string      { return "serve" }
+func (cmd *serveCommand) Args() string      { return "" }
+func (cmd *serveCommand) ShortHelp() string { return "Update the table from GitHub webhooks." }
+func (cmd *serveCommand) LongHelp() string  { return serveHelp }
+func (cmd *serveCommand) Hidden() bool      { return false }
+
+func (cmd *serveCommand) Register(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.addr, "addr", ":8080", "address to listen on for webhook deliveries")
+	fs.StringVar(&cmd.secret, "webhook-secret", os.Getenv("GITHUB_WEBHOOK_SECRET"), "secret the webhook deliveries are signed with (or env var GITHUB_WEBHOOK_SECRET)")
+}
+
+func (cmd *serveCommand) Run(ctx context.Context, args []string) error {
+	if len(cmd.secret) < 1 {
+		return errors.New("webhook secret cannot be empty")
+	}
+
+	// On ^C, or SIGTERM handle exit.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	signal.Notify(signals, syscall.SIGTERM)
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		sig := <-signals
+		logrus.Infof("Received %s, exiting.", sig.String())
+		cancel()
+	}()
+
+	bots, err := newBots(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Every job handles its deliveries one at a time, in the same loop as
+	// its periodic sync, so they never race.
+	handler := &webhookHandler{secret: []byte(cmd.secret)}
+	for _, bot := range bots {
+		// Sync the whole table first, so we know the records that are in
+		// it.
+		if err := bot.run(ctx); err != nil {
+			return err
+		}
+
+		deliveries := make(chan []change, 100)
+		handler.deliveries = append(handler.deliveries, deliveries)
+		go bot.serve(ctx, deliveries)
+	}
+
+	srv := &http.Server{
+		Addr:    cmd.addr,
+		Handler: handler,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	logrus.Infof("Listening for webhook deliveries on %s", cmd.addr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// serve updates the records from the webhook deliveries, and syncs the whole
+// table every interval, until the context is done.
+func (bot *bot) serve(ctx context.Context, deliveries <-chan []change) {
+	ticker := time.NewTicker(bot.job.Interval)
+	defer ticker.Stop()
+
+	bot.log.Infof("Starting bot to update airtable table %s for base %s from webhooks, and every %s", bot.job.Airtable.Table, bot.job.Airtable.BaseID, bot.job.Interval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := bot.run(ctx); err != nil {
+				bot.log.Errorf("Syncing the table failed: %v", err)
+			}
+		case changes := <-deliveries:
+			if err := bot.refresh(ctx, changes); err != nil {
+				bot.log.Errorf("Updating records from webhook failed: %v", err)
+			}
+		}
+	}
+}
+
+// change is an issue or pull request a webhook delivery told us about. If
+// item is nil and gone is not set, the issue is fetched from its source.
+type change struct {
+	ref   reference
+	item  *item
+	gone  bool
+	label string
+}
+
+// webhookHandler verifies the webhook deliveries and passes the changes in
+// them on to every job.
+type webhookHandler struct {
+	secret     []byte
+	deliveries []chan<- []change
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !validSignature(r.Header.Get("X-Hub-Signature-256"), payload, h.secret) {
+		logrus.Warnf("Rejected webhook delivery %s with an invalid signature", r.Header.Get("X-GitHub-Delivery"))
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	event := r.Header.Get("X-GitHub-Event")
+	changes, err := webhookChanges(event, payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(changes) == 0 {
+		// The event is not one we care about.
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	logrus.Debugf("received %s webhook delivery %s", event, r.Header.Get("X-GitHub-Delivery"))
+	for _, deliveries := range h.deliveries {
+		// Never wait on a job that is busy syncing, GitHub gives up on the
+		// delivery after 10 seconds. The next sync picks up what we drop.
+		select {
+		case deliveries <- changes:
+		default:
+			logrus.Warnf("Dropped webhook delivery %s for a job with too many deliveries queued", r.Header.Get("X-GitHub-Delivery"))
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// validSignature reports whether the X-Hub-Signature-256 header is the HMAC of
+// the payload with the secret.
+func validSignature(header string, payload, secret []byte) bool {
+	if !strings.HasPrefix(header, "sha256=") {
+		return false
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(header, "sha256="))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+// webhookChanges returns the changes for a webhook delivery.
+func webhookChanges(event string, payload []byte) ([]change, error) {
+	switch event {
+	case "issues", "issue_comment", "pull_request", "label":
+	default:
+		return nil, nil
+	}
+
+	e, err := github.ParseWebHook(event, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e := e.(type) {
+	case *github.IssuesEvent:
+		owner, repo := e.GetRepo().GetOwner().GetLogin(), e.GetRepo().GetName()
+		c := change{
+			ref:  reference{Owner: owner, Repo: repo, Number: e.GetIssue().GetNumber()},
+			item: newGitHubItem(owner, repo, e.GetIssue(), false),
+		}
+		switch e.GetAction() {
+		case "deleted":
+			c.item = nil
+			c.gone = true
+		case "transferred":
+			// Fetch it, which follows it to where it was transferred.
+			c.item = nil
+		}
+		return []change{c}, nil
+	case *github.IssueCommentEvent:
+		owner, repo := e.GetRepo().GetOwner().GetLogin(), e.GetRepo().GetName()
+		ref := reference{Owner: owner, Repo: repo, Number: e.GetIssue().GetNumber()}
+		if e.GetIssue().IsPullRequest() {
+			// The issue in the payload does not say if the pull request
+			// was merged, so fetch it.
+			return []change{{ref: ref}}, nil
+		}
+		return []change{{ref: ref, item: newGitHubItem(owner, repo, e.GetIssue(), false)}}, nil
+	case *github.PullRequestEvent:
+		owner, repo := e.GetRepo().GetOwner().GetLogin(), e.GetRepo().GetName()
+		pr := e.GetPullRequest()
+		issue := &github.Issue{
+			Number:           pr.Number,
+			Title:            pr.Title,
+			State:            pr.State,
+			User:             pr.User,
+			Comments:         pr.Comments,
+			HTMLURL:          pr.HTMLURL,
+			UpdatedAt:        pr.UpdatedAt,
+			CreatedAt:        pr.CreatedAt,
+			ClosedAt:         pr.ClosedAt,
+			Assignees:        pr.Assignees,
+			Milestone:        pr.Milestone,
+			PullRequestLinks: &github.PullRequestLinks{HTMLURL: pr.HTMLURL},
+		}
+		for _, label := range pr.Labels {
+			issue.Labels = append(issue.Labels, *label)
+		}
+		i := newGitHubItem(owner, repo, issue, pr.GetMerged())
+
+		// The pull request type we use does not have the draft status.
+		var d struct {
+			PullRequest struct {
+				Draft bool `json:"draft"`
+			} `json:"pull_request"`
+		}
+		if err := json.Unmarshal(payload, &d); err != nil {
+			return nil, err
+		}
+		i.draft = d.PullRequest.Draft
+
+		return []change{{
+			ref:  reference{Owner: owner, Repo: repo, Number: pr.GetNumber()},
+			item: i,
+		}}, nil
+	case *github.LabelEvent:
+		// The label event does not say which issues have the label, so
+		// the bot looks for them in the records. When the label was
+		// renamed, the records still have the old name.
+		var l struct {
+			Changes struct {
+				Name *struct {
+					From string `json:"from"`
+				} `json:"name"`
+			} `json:"changes"`
+		}
+		if err := json.Unmarshal(payload, &l); err != nil {
+			return nil, err
+		}
+		label := e.GetLabel().GetName()
+		if l.Changes.Name != nil {
+			label = l.Changes.Name.From
+		}
+		return []change{{
+			ref:   reference{Owner: e.GetRepo().GetOwner().GetLogin(), Repo: e.GetRepo().GetName()},
+			label: label,
+		}}, nil
+	}
+
+	return nil, fmt.Errorf("unexpected payload for %s event", event)
+}
+
+// refresh updates the records for the changes from a webhook delivery.
+func (bot *bot) refresh(ctx context.Context, changes []change) error {
+	// Expand the label changes into the records with the label in the
+	// repository.
+	expanded := []change{}
+	for _, c := range changes {
+		if c.label == "" {
+			expanded = append(expanded, c)
+			continue
+		}
+		for key, record := range bot.records {
+			ref, err := parseReference(key)
+			if err != nil || ref.Host != c.ref.Host || ref.Owner != c.ref.Owner || ref.Repo != c.ref.Repo {
+				continue
+			}
+			if in(record.Fields.Labels, c.label) {
+				expanded = append(expanded, change{ref: ref})
+			}
+		}
+	}
+	changes = expanded
+
+	errs := forEach(ctx, len(changes), concurrency, func(n int) error {
+		c := changes[n]
+		if c.item != nil || c.gone {
+			return nil
+		}
+
+		src := bot.source(c.ref.Host)
+		if src == nil {
+			return fmt.Errorf("no source configured for reference %s", c.ref)
+		}
+		i, err := src.Item(ctx, c.ref)
+		if err == errNotFound {
+			changes[n].gone = true
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("getting issue failed: %v", err)
+		}
+		changes[n].item = i
+		return nil
+	})
+
+	w := writes{}
+	for n, c := range changes {
+		if errs[n] != nil {
+			w.failed.add(c.ref.String(), errs[n])
+			continue
+		}
+
+		record, exists := bot.records[c.ref.String()]
+		switch {
+		case c.gone && exists && bot.job.Retention.Gone == retentionMark:
+			marked := bot.job.Retention.markGone(record)
+			if changed := changedFields(record.Fields, marked.Fields); len(changed) > 0 {
+				w.updates = append(w.updates, marked)
+				w.existing = append(w.existing, record)
+			}
+		case c.gone && exists:
+			w.destroys = append(w.destroys, record)
+		case c.gone:
+		case exists && bot.job.Filters.Prune && !bot.job.Filters.match(c.item):
+			w.destroys = append(w.destroys, record)
+		case exists && c.item.ref != c.ref && bot.records[c.item.ref.String()].ID != "":
+			// It moved to where the table already has a record for it.
+			w.destroys = append(w.destroys, record)
+		case exists:
+			fresh := bot.newRecord(c.item, record.ID)
+			if changed := changedFields(record.Fields, fresh.Fields); len(changed) > 0 {
+				bot.log.Debugf("record %s for issue %s changed: %s", record.ID, record.Fields.Reference, strings.Join(changed, ", "))
+				w.updates = append(w.updates, fresh)
+				w.existing = append(w.existing, record)
+			} else {
+				w.unchanged++
+			}
+		case bot.inScope(c.item) && bot.job.Filters.match(c.item) && !bot.job.Retention.expired(c.item.fields):
+			// Only the repositories are known, whether a new issue is part of
+			// the job's my work or search is left for the next sync.
+			w.creates = append(w.creates, bot.newRecord(c.item, ""))
+		}
+	}
+
+	bot.write(ctx, w)
+	bot.track(w)
+	bot.log.Infof("Synced records from webhook: %d created, %d updated, %d unchanged, %d deleted", len(w.creates), len(w.updates), w.unchanged, len(w.destroys))
+
+	return w.failed.errorOrNil()
+}
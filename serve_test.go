@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestValidSignature(t *testing.T) {
+	secret := []byte("It's a Secret to Everybody")
+	payload := []byte("Hello, World!")
+
+	sign := func(secret []byte) string {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(payload)
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	sha1Mac := hmac.New(sha1.New, secret)
+	sha1Mac.Write(payload)
+
+	testCases := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{
+			// The example from the GitHub docs on validating deliveries.
+			name:   "valid",
+			header: "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17",
+			want:   true,
+		},
+		{
+			name:   "signed here",
+			header: sign(secret),
+			want:   true,
+		},
+		{
+			name:   "other secret",
+			header: sign([]byte("another secret")),
+		},
+		{
+			name:   "sha1",
+			header: "sha1=" + hex.EncodeToString(sha1Mac.Sum(nil)),
+		},
+		{
+			name:   "no prefix",
+			header: sign(secret)[len("sha256="):],
+		},
+		{
+			name:   "not hex",
+			header: "sha256=not-hex",
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := validSignature(tc.header, payload, secret); got != tc.want {
+				t.Fatalf("expected %t for %q, got %t", tc.want, tc.header, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+)
+
+// Sink defines the interface for a destination that records are synced to.
+//
+// Records are keyed by their Fields.Reference, the ID is opaque to the bot
+// and only has meaning to the sink that returned it. The write methods take
+// many records at once so sinks can batch their requests, if some of the
+// records fail to be written the error returned is a syncErrors holding
+// their references.
+type Sink interface {
+	// ListRecords returns all the records currently in the sink.
+	ListRecords(ctx context.Context) ([]githubRecord, error)
+	// CreateRecords creates new records and sets the ID on each of the
+	// records passed.
+	CreateRecords(ctx context.Context, records []githubRecord) error
+	// UpdateRecords updates the existing records matching the records' IDs.
+	UpdateRecords(ctx context.Context, records []githubRecord) error
+	// DestroyRecords deletes the records from the sink.
+	DestroyRecords(ctx context.Context, records []githubRecord) error
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errNotFound is returned by a Source when an issue or pull request no longer
+// exists.
+var errNotFound = errors.New("not found")
+
+// Source defines the interface for a forge that issues and pull requests are
+// synced from.
+type Source interface {
+	// Host returns the prefix used in references for the source.
+	// The default GitHub source returns an empty string, so references
+	// without a prefix are resolved by it.
+	Host() string
+	// Item returns the issue or pull request for the reference.
+	Item(ctx context.Context, ref reference) (*item, error)
+	// Repositories returns the repositories to autofill.
+	Repositories(ctx context.Context) ([]repository, error)
+	// Items returns all the issues and pull requests for the repository
+	// updated after since.
+	Items(ctx context.Context, repo repository, since time.Time) ([]*item, error)
+}
+
+// watcher is implemented by a Source that can list the repositories the
+// user is watching.
+type watcher interface {
+	WatchedRepositories(ctx context.Context) ([]repository, error)
+}
+
+// starrer is implemented by a Source that can list the repositories starred
+// by a user, or by the token's user if user is empty.
+type starrer interface {
+	StarredRepositories(ctx context.Context, user string) ([]repository, error)
+}
+
+// inboxer is implemented by a Source that can list the open issues and pull
+// requests the token's user is involved in, across all repositories.
+type inboxer interface {
+	Inbox(ctx context.Context) ([]*item, error)
+}
+
+// batcher is implemented by a Source that can fetch many issues and pull
+// requests at once. References missing from the map returned, including the
+// ones that no longer exist, need to be fetched with Item.
+type batcher interface {
+	BatchItems(ctx context.Context, refs []reference) (map[string]*item, error)
+}
+
+// searcher is implemented by a Source that can search for issues and pull
+// requests across repositories.
+type searcher interface {
+	Search(ctx context.Context, query string) ([]*item, error)
+}
+
+// teamer is implemented by a Source that can scope autofill to teams, it
+// returns the members of the teams.
+type teamer interface {
+	TeamMembers(ctx context.Context) ([]string, error)
+}
+
+// repository defines a repository on a source.
+type repository struct {
+	Host  string
+	Owner string
+	Name  string
+
+	// Topics, Visibility, Fork and Archived are used to filter the
+	// repositories to autofill. Visibility is public, private or internal.
+	Topics     []string
+	Visibility string
+	Fork       bool
+	Archived   bool
+}
+
+// FullName returns the repository in the format {owner}/{repo}.
+func (r repository) FullName() string {
+	return r.Owner + "/" + r.Name
+}
+
+// String returns the repository in the format [{host}:]{owner}/{repo}, the
+// same as the prefix of its references.
+func (r repository) String() string {
+	if r.Host != "" {
+		return r.Host + ":" + r.FullName()
+	}
+	return r.FullName()
+}
+
+// item is an issue, pull request or merge request normalized from a Source.
+type item struct {
+	ref    reference
+	fields Fields
+	// raw is the issue or pull request as the source returned it, so
+	// computed columns can use everything it has.
+	raw interface{}
+	// draft is set for pull requests that are drafts.
+	draft bool
+}
+
+// ownedBy reports whether the issue is authored by or assigned to one of the
+// users.
+func (i *item) ownedBy(users []string) bool {
+	if in(users, i.fields.Author) {
+		return true
+	}
+	for _, assignee := range i.fields.Assignees {
+		if in(users, assignee) {
+			return true
+		}
+	}
+	return false
+}
+
+// reference defines an issue or pull request reference in the format
+// [{host}:]{owner}/{repo}#{number}, or [{host}:]{owner}/{repo}!{number} for
+// GitLab merge requests which are numbered separately from issues.
+type reference struct {
+	Host         string
+	Owner        string
+	Repo         string
+	Number       int
+	MergeRequest bool
+}
+
+// String returns the reference in its canonical format.
+func (r reference) String() string {
+	sep := "#"
+	if r.MergeRequest {
+		sep = "!"
+	}
+	s := fmt.Sprintf("%s/%s%s%d", r.Owner, r.Repo, sep, r.Number)
+	if r.Host != "" {
+		s = r.Host + ":" + s
+	}
+	return s
+}
+
+// repository returns the repository the issue or pull request is in.
+func (r reference) repository() repository {
+	return repository{Host: r.Host, Owner: r.Owner, Name: r.Repo}
+}
+
+func parseReference(ref string) (reference, error) {
+	// Split the reference into repository and issue number.
+	n := strings.LastIndexAny(ref, "#!")
+	if n < 0 {
+		return reference{}, fmt.Errorf("could not parse reference name into repository and issue number for %s", ref)
+	}
+	repolong := ref[:n]
+	i := ref[n+1:]
+	mr := ref[n] == '!'
+
+	// Parse the string id into an int.
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		return reference{}, err
+	}
+
+	repo, err := parseRepository(repolong)
+	if err != nil {
+		return reference{}, err
+	}
+
+	return reference{
+		Host:         repo.Host,
+		Owner:        repo.Owner,
+		Repo:         repo.Name,
+		Number:       id,
+		MergeRequest: mr,
+	}, nil
+}
+
+// parseRepository parses a repository in the format [{host}:]{owner}/{repo}.
+func parseRepository(name string) (repository, error) {
+	// Split off the host prefix, if there is one. The host itself may
+	// contain a port so only look before the owner.
+	var host string
+	if i := strings.Index(name, "/"); i > 0 {
+		if j := strings.LastIndex(name[:i], ":"); j >= 0 {
+			host = name[:j]
+			name = name[j+1:]
+		}
+	}
+
+	// Split the repo name into owner and repo, the owner may contain
+	// slashes for sources with nested groups.
+	n := strings.LastIndex(name, "/")
+	if n < 1 || n == len(name)-1 {
+		return repository{}, fmt.Errorf("could not parse reference name into owner and repo for %s", name)
+	}
+
+	return repository{
+		Host:  host,
+		Owner: name[:n],
+		Name:  name[n+1:],
+	}, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	testCases := []struct {
+		ref  string
+		want reference
+		err  bool
+	}{
+		{
+			ref:  "jessfraz/gitable#12",
+			want: reference{Owner: "jessfraz", Repo: "gitable", Number: 12},
+		},
+		{
+			ref:  "gitlab.com:group/project#3",
+			want: reference{Host: "gitlab.com", Owner: "group", Repo: "project", Number: 3},
+		},
+		{
+			ref:  "gitlab.com:group/sub/project!7",
+			want: reference{Host: "gitlab.com", Owner: "group/sub", Repo: "project", Number: 7, MergeRequest: true},
+		},
+		{
+			ref:  "gitlab.example.com:8443:group/sub/deeper/project!7",
+			want: reference{Host: "gitlab.example.com:8443", Owner: "group/sub/deeper", Repo: "project", Number: 7, MergeRequest: true},
+		},
+		{
+			ref:  "127.0.0.1:3000:org/repo#1",
+			want: reference{Host: "127.0.0.1:3000", Owner: "org", Repo: "repo", Number: 1},
+		},
+		{ref: "jessfraz/gitable", err: true},
+		{ref: "jessfraz/gitable#twelve", err: true},
+		{ref: "gitable#12", err: true},
+		{ref: "jessfraz/#12", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.ref, func(t *testing.T) {
+			got, err := parseReference(tc.ref)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %#v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("expected %#v, got %#v", tc.want, got)
+			}
+			if got.String() != tc.ref {
+				t.Fatalf("expected %s to round trip, got %s", tc.ref, got.String())
+			}
+		})
+	}
+}
+
+func TestParseRepository(t *testing.T) {
+	testCases := []struct {
+		name string
+		want repository
+		err  bool
+	}{
+		{
+			name: "jessfraz/gitable",
+			want: repository{Owner: "jessfraz", Name: "gitable"},
+		},
+		{
+			name: "gitlab.com:group/sub/project",
+			want: repository{Host: "gitlab.com", Owner: "group/sub", Name: "project"},
+		},
+		{
+			name: "gitea.example.com:3000:org/repo",
+			want: repository{Host: "gitea.example.com:3000", Owner: "org", Name: "repo"},
+		},
+		{name: "gitable", err: true},
+		{name: "jessfraz/", err: true},
+		{name: "/gitable", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseRepository(tc.name)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %#v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Host != tc.want.Host || got.Owner != tc.want.Owner || got.Name != tc.want.Name {
+				t.Fatalf("expected %#v, got %#v", tc.want, got)
+			}
+			if got.String() != tc.name {
+				t.Fatalf("expected %s to round trip, got %s", tc.name, got.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// syncState is the durable state we keep between runs, stored as a JSON file.
+//
+// It records a cursor per table and repository, which is the time we last
+// fetched the repository's issues, so incremental fetches only ask for what
+// changed since.
+type syncState struct {
+	mu   sync.Mutex
+	path string
+
+	// Cursors maps a table to the cursors for its repositories.
+	Cursors map[string]map[string]time.Time `json:"cursors"`
+}
+
+// defaultStateFile returns the state file in the user's cache directory, so
+// the cursors survive restarts, unlike in the temporary directory.
+func defaultStateFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "gitable", "state.json")
+}
+
+// loadState reads the state from the file at path. If the file does not exist
+// yet we start with an empty state.
+func loadState(path string) (*syncState, error) {
+	s := &syncState{
+		path:    path,
+		Cursors: map[string]map[string]time.Time{},
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	if s.Cursors == nil {
+		s.Cursors = map[string]map[string]time.Time{}
+	}
+
+	return s, nil
+}
+
+// cursor returns the cursor for the repository in the table, and whether there
+// was one.
+func (s *syncState) cursor(table, repo string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.Cursors[table][repo]
+	return t, ok
+}
+
+// setCursors sets the cursors for the repositories in the table.
+func (s *syncState) setCursors(table string, cursors map[string]time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Cursors[table] == nil {
+		s.Cursors[table] = map[string]time.Time{}
+	}
+	for repo, t := range cursors {
+		s.Cursors[table][repo] = t
+	}
+}
+
+// reset removes the cursors for the repositories in the table, or all the
+// cursors for the table if no repositories are given.
+func (s *syncState) reset(table string, repos []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(repos) == 0 {
+		delete(s.Cursors, table)
+		return
+	}
+	for _, repo := range repos {
+		delete(s.Cursors[table], repo)
+	}
+}
+
+// save writes the state to its file. We write to a temporary file of our own
+// first and rename it, so a crash never leaves a half written state behind.
+func (s *syncState) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// forEach calls fn for every index in [0, n) using at most concurrency
+// goroutines. The returned errors are indexed the same as the calls, so
+// callers can report them in a deterministic order.
+func forEach(ctx context.Context, n, concurrency int, fn func(i int) error) []error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	errs := make([]error, n)
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		if err := ctx.Err(); err != nil {
+			errs[i] = err
+			continue
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return errs
+}
+
+// syncError is the error for a single reference in a run.
+type syncError struct {
+	reference string
+	err       error
+}
+
+// syncErrors aggregates the errors for all the references that failed in a
+// run.
+type syncErrors []syncError
+
+// add appends the error for the reference, if it is not nil.
+func (e *syncErrors) add(reference string, err error) {
+	if err == nil {
+		return
+	}
+	*e = append(*e, syncError{reference: reference, err: err})
+}
+
+// errorOrNil sorts the errors by reference and returns them as a single
+// error, or nil if there were none.
+func (e syncErrors) errorOrNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	sort.SliceStable(e, func(i, j int) bool {
+		return e[i].reference < e[j].reference
+	})
+	return e
+}
+
+func (e syncErrors) Error() string {
+	lines := []string{fmt.Sprintf("%d references failed to sync:", len(e))}
+	for _, s := range e {
+		lines = append(lines, fmt.Sprintf("  %s: %v", s.reference, s.err))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sleep waits for the duration, or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// rateLimiter limits the calls to an API, shared across goroutines, to a
+// fixed number per second.
+type rateLimiter struct {
+	ticker *time.Ticker
+}
+
+// newRateLimiter creates a new limiter allowing perSecond calls every second.
+func newRateLimiter(perSecond int) *rateLimiter {
+	return &rateLimiter{
+		ticker: time.NewTicker(time.Second / time.Duration(perSecond)),
+	}
+}
+
+// wait blocks until the next call is allowed.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-l.ticker.C:
+		return nil
+	}
+}
+
+// stop releases the ticker of the limiter, it must not be waited on after.
+func (l *rateLimiter) stop() {
+	l.ticker.Stop()
+}